@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	mpv "github.com/nbr23/go-mpv"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// barPollInterval is how often --bar checks that mpv is still there.
+const barPollInterval = 5 * time.Second
+
+func barLine(p *somafm.Player) (string, error) {
+	c, title, err := p.NowPlaying()
+	if err != nil {
+		return "", err
+	}
+	if c == nil && title == "" {
+		return "⏹ nothing playing", nil
+	}
+	state := "▶"
+	if paused, _ := p.Client().Pause(); paused {
+		state = "⏸"
+	}
+	name := "mpv"
+	if c != nil {
+		name = c.ChannelTitle
+	}
+	if title == "" {
+		return fmt.Sprintf("%s %s", state, name), nil
+	}
+	return fmt.Sprintf("%s %s — %s", state, name, title), nil
+}
+
+// runBar prints a status line each time the playback state changes, until
+// ctx is done or mpv goes away.
+func runBar(ctx context.Context, p *somafm.Player, config *somaConfig) error {
+	if err := p.Connect(ctx); err != nil {
+		return fmt.Errorf("unable to connect to mpv: %w", err)
+	}
+	p.SetChannels(config.Channels.Channels)
+
+	// The event handler runs on the IPC read loop and can't query mpv
+	// itself, it only wakes up the loop below.
+	changed := make(chan struct{}, 1)
+	client := p.Client()
+	client.RegisterHandler(func(r *mpv.Response) {
+		if r.Event != "property-change" {
+			return
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	for _, property := range []string{"media-title", "pause", "path"} {
+		client.ObserveProperty(property)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	last := ""
+	ticker := time.NewTicker(barPollInterval)
+	defer ticker.Stop()
+
+	for {
+		line, err := barLine(p)
+		if err != nil {
+			fmt.Fprintln(out, "⏹ mpv not running")
+			out.Flush()
+			return fmt.Errorf("lost connection to mpv: %w", err)
+		}
+		if line != last {
+			fmt.Fprintln(out, line)
+			out.Flush()
+			last = line
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
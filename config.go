@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+type somaConfig struct {
+	ConfigVersion          int                       `json:"configVersion"`
+	CurrentlyPlaying       string                    `json:"currentlyPlaying"`
+	IsPaused               bool                      `json:"isPaused"`
+	Channels               somafm.Channels           `json:"channels"`
+	LastChannelsListUpdate time.Time                 `json:"lastChannelsListUpdate"`
+	Favorites              []string                  `json:"favorites"`
+	ShowPagination         bool                      `json:"showPagination"`
+	ShowStatusBar          bool                      `json:"showStatusBar"`
+	ShowHelp               bool                      `json:"showHelp"`
+	OnTrackChange          string                    `json:"onTrackChange"`
+	PreferredQuality       somafm.Quality            `json:"preferredQuality"`
+	QualityByChannel       map[string]somafm.Quality `json:"qualityByChannel"`
+	QualityByGenre         map[string]somafm.Quality `json:"qualityByGenre"`
+	Theme                  string                    `json:"theme"`
+	GroupByGenre           bool                      `json:"groupByGenre"`
+	SortMode               somafm.SortOrder          `json:"sortMode"`
+	Selected               string                    `json:"selected"`
+	ShowClock              bool                      `json:"showClock"`
+	Presets                map[string][]string       `json:"presets"`
+	CacheSecs              float64                   `json:"cacheSecs"`
+	WrapNavigation         bool                      `json:"wrapNavigation"`
+	SamplerSeconds         int                       `json:"samplerSeconds"`
+	Diagnostics            bool                      `json:"diagnostics"`
+	StatusFormat           string                    `json:"statusFormat"`
+	KeepPlayingOnExit      bool                      `json:"keepPlayingOnExit"`
+	AutoPlay               bool                      `json:"autoPlay"`
+	Aliases                map[string]string         `json:"aliases"`
+	HistoryMaxEntries      int                       `json:"historyMaxEntries"`
+	HistoryMaxDays         int                       `json:"historyMaxDays"`
+	TitleDebounceMs        int                       `json:"titleDebounceMs"`
+	Watches                []string                  `json:"watches"`
+	OnWatch                string                    `json:"onWatch"`
+	AudioDevice            string                    `json:"audioDevice"`
+	Keys                   map[string]string         `json:"keys"`
+	Recent                 []string                  `json:"recent"`
+	Margin                 []int                     `json:"margin"`
+	Padding                []int                     `json:"padding"`
+	Prefetch               bool                      `json:"prefetch"`
+	Notes                  map[string]string         `json:"notes"`
+	QuietHours             []quietHours              `json:"quietHours"`
+	EnterAction            string                    `json:"enterAction"`
+	SlowOnBattery          bool                      `json:"slowOnBattery"`
+	StopAfterPauseMinutes  int                       `json:"stopAfterPauseMinutes"`
+	Glyphs                 glyphs                    `json:"glyphs"`
+	BackgroundRefresh      bool                      `json:"backgroundRefresh"`
+	Lite                   bool                      `json:"lite"`
+	LogLevel               string                    `json:"logLevel"`
+	Categories             map[string]string         `json:"categories"`
+	RotateFavorites        bool                      `json:"rotateFavorites"`
+}
+
+func defaultConfig() *somaConfig {
+	return &somaConfig{
+		ShowPagination:    true,
+		ShowStatusBar:     false,
+		ShowHelp:          true,
+		PreferredQuality:  somafm.QualityHighest,
+		SamplerSeconds:    20,
+		AutoPlay:          true,
+		HistoryMaxEntries: 1000,
+		HistoryMaxDays:    30,
+		TitleDebounceMs:   1000,
+	}
+}
+
+// configFile overrides where soma.json is read and written, see --config.
+var configFile string
+
+func configPath() (string, error) {
+	if configFile != "" {
+		return configFile, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "soma.json"), nil
+}
+
+// probeConfigDir checks that the config file's directory can be written to,
+// creating it if needed, by writing and removing a scratch file.
+func probeConfigDir(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".soma-probe-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkConfigWritable warns when the config can't be saved, which would
+// otherwise only show as state silently not persisting. Unless the path was
+// chosen with --config, it then switches to a copy of the config in the
+// user cache directory, when that one is writable.
+func checkConfigWritable() {
+	path, err := configPath()
+	if err != nil {
+		return
+	}
+	err = probeConfigDir(path)
+	if err == nil {
+		return
+	}
+	logger.Warn("config directory is not writable", "path", path, "error", err)
+	if configFile != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not writable, settings and playback state won't be saved: %s\n", path, err)
+		return
+	}
+
+	cacheDir, cerr := os.UserCacheDir()
+	fallback := filepath.Join(cacheDir, "soma", "soma.json")
+	if cerr != nil || probeConfigDir(fallback) != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not writable, settings and playback state won't be saved. Use --config to pick another location: %s\n", path, err)
+		return
+	}
+	if _, err := os.Stat(fallback); os.IsNotExist(err) {
+		if data, err := os.ReadFile(path); err == nil {
+			os.WriteFile(fallback, data, 0644)
+		}
+	}
+	configFile = fallback
+	fmt.Fprintf(os.Stderr, "Warning: %s is not writable, using %s instead. Use --config to pick another location.\n", path, fallback)
+}
+
+func (c *somaConfig) saveConfig() error {
+	if err := c.writeConfig(); err != nil {
+		return fmt.Errorf("%w: %w", errConfigUnwritable, err)
+	}
+	return nil
+}
+
+func (c *somaConfig) writeConfig() error {
+	if c == nil {
+		return nil
+	}
+	configPath, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(configPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	c.ConfigVersion = configVersion
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// cacheClock is the clock the channel cache ages by, time.Now but for tests
+// of the expiry.
+var cacheClock = time.Now
+
+// fetchChannelList fetches the channel list, somafm.FetchChannels but for
+// tests of the cache.
+var fetchChannelList = somafm.FetchChannels
+
+// channelsStale reports whether the cached channel list is missing or more
+// than a week old.
+func (c *somaConfig) channelsStale() bool {
+	return len(c.Channels.Channels) == 0 || cacheClock().Sub(c.LastChannelsListUpdate) > 24*time.Hour*7
+}
+
+// refreshChannels updates the cached channel list if it is empty or more
+// than a week old. If SomaFM can't be reached, a stale cache is kept and the
+// update is retried next time.
+func (c *somaConfig) refreshChannels(ctx context.Context) error {
+	if !c.channelsStale() {
+		return nil
+	}
+	err := c.updateChannels(ctx)
+	if err != nil && len(c.Channels.Channels) != 0 {
+		logger.Warn("using cached channels", "error", err)
+		fmt.Fprintln(os.Stderr, "Warning: unable to refresh the channel list, using the cached one:", err)
+		return nil
+	}
+	return err
+}
+
+// updateChannels fetches the channel list and caches it.
+func (c *somaConfig) updateChannels(ctx context.Context) error {
+	ch, err := fetchChannelList(ctx)
+	if err != nil {
+		return err
+	}
+	c.LastChannelsListUpdate = cacheClock()
+	c.Channels = *ch
+	return nil
+}
+
+// findChannel resolves what the user typed to a channel: an alias, a
+// channel id, or part of a channel's name.
+func (c *somaConfig) findChannel(query string) (*somafm.Channel, error) {
+	if id, ok := c.Aliases[query]; ok {
+		ch, ok := c.Channels.Find(id)
+		if !ok {
+			return nil, fmt.Errorf("%w: alias %q points to %q", somafm.ErrChannelNotFound, query, id)
+		}
+		return ch, nil
+	}
+	return somafm.Resolve(c.Channels.Channels, query)
+}
+
+func (c *somaConfig) isFavorite(id string) bool {
+	return slices.Contains(c.Favorites, id)
+}
+
+func (c *somaConfig) addFavorite(id string) {
+	if !c.isFavorite(id) {
+		c.Favorites = append(c.Favorites, id)
+	}
+}
+
+// addRecent puts id at the front of the recently played channels, keeping
+// the switcherSize most recent.
+func (c *somaConfig) addRecent(id string) {
+	c.Recent = slices.DeleteFunc(c.Recent, func(r string) bool { return r == id })
+	c.Recent = slices.Insert(c.Recent, 0, id)
+	c.Recent = c.Recent[:min(len(c.Recent), switcherSize)]
+}
+
+func (c *somaConfig) removeFavorite(id string) {
+	c.Favorites = slices.DeleteFunc(c.Favorites, func(f string) bool { return f == id })
+}
+
+// artworkCacheTTL is how long downloaded channel images are kept.
+const artworkCacheTTL = 30 * 24 * time.Hour
+
+// newArtworkCache returns the image cache, next to the config file like the
+// history, wherever --config or a read-only config directory put it.
+func newArtworkCache() (*somafm.ArtworkCache, error) {
+	configPath, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	return somafm.NewArtworkCache(filepath.Join(filepath.Dir(configPath), "soma", "artwork"), artworkCacheTTL), nil
+}
+
+func loadConfig() (*somaConfig, error) {
+	configPath, err := configPath()
+	if err != nil {
+		return defaultConfig(), err
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return defaultConfig(), err
+	}
+	data, err = migrateConfig(data)
+	if err != nil {
+		return defaultConfig(), fmt.Errorf("%w %s: %w", errConfigInvalid, configPath, err)
+	}
+
+	c := defaultConfig()
+	if err := json.Unmarshal(data, c); err != nil {
+		return defaultConfig(), fmt.Errorf("%w %s: %w", errConfigInvalid, configPath, err)
+	}
+	if err := c.validate(); err != nil {
+		return defaultConfig(), fmt.Errorf("%w %s: %w", errConfigInvalid, configPath, err)
+	}
+
+	return c, nil
+}
+
+// What enter does on the channel playing: enterToggle, the default, pauses
+// it, and enterPlay starts its stream again.
+const (
+	enterToggle = "toggle"
+	enterPlay   = "play"
+)
+
+// qualityOverrides returns the per-channel and per-genre qualities, which
+// take precedence over PreferredQuality.
+func (c *somaConfig) qualityOverrides() somafm.QualityOverrides {
+	return somafm.QualityOverrides{Channels: c.QualityByChannel, Genres: c.QualityByGenre}
+}
+
+// categories returns SomaFM's genres grouped into categories, with the
+// configured ones taking precedence.
+func (c *somaConfig) categories() somafm.Categories {
+	return somafm.DefaultCategories.With(c.Categories)
+}
+
+// validate checks the settings that decoding alone doesn't.
+func (c *somaConfig) validate() error {
+	if _, ok := logLevels[c.LogLevel]; c.LogLevel != "" && !ok {
+		return fmt.Errorf("logLevel: %q is not one of error, warn, info or debug", c.LogLevel)
+	}
+	for genre, category := range c.Categories {
+		if strings.TrimSpace(category) == "" {
+			return fmt.Errorf("categories: %q has an empty category", genre)
+		}
+	}
+	if c.StopAfterPauseMinutes < 0 {
+		return fmt.Errorf("stopAfterPauseMinutes: %d is negative", c.StopAfterPauseMinutes)
+	}
+	switch c.EnterAction {
+	case "", enterToggle, enterPlay:
+	default:
+		return fmt.Errorf("enterAction: %q is neither %q nor %q", c.EnterAction, enterToggle, enterPlay)
+	}
+	for _, qualities := range []map[string]somafm.Quality{c.QualityByChannel, c.QualityByGenre} {
+		for name, q := range qualities {
+			if _, err := somafm.ParseQuality(string(q)); err != nil {
+				return fmt.Errorf("quality of %s: %w", name, err)
+			}
+		}
+	}
+	if _, err := newKeymap(c.Keys); err != nil {
+		return err
+	}
+	if _, err := newDocStyle(c.Margin, c.Padding); err != nil {
+		return err
+	}
+	return validateQuietHours(c.QuietHours)
+}
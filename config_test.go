@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+func TestRefreshChannels(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		cached  int
+		age     time.Duration
+		fetchOK bool
+		fetched bool
+		want    int
+		err     bool
+	}{
+		{name: "no cache", fetchOK: true, fetched: true, want: 2},
+		{name: "fresh", cached: 1, age: 6 * 24 * time.Hour, fetchOK: true, want: 1},
+		{name: "a week old", cached: 1, age: 7 * 24 * time.Hour, fetchOK: true, want: 1},
+		{name: "expired", cached: 1, age: 8 * 24 * time.Hour, fetchOK: true, fetched: true, want: 2},
+		{name: "expired and offline", cached: 1, age: 8 * 24 * time.Hour, fetched: true, want: 1},
+		{name: "no cache and offline", fetched: true, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(clock func() time.Time, fetch func(context.Context) (*somafm.Channels, error)) {
+				cacheClock, fetchChannelList = clock, fetch
+			}(cacheClock, fetchChannelList)
+			cacheClock = func() time.Time { return now }
+			fetches := 0
+			fetchChannelList = func(context.Context) (*somafm.Channels, error) {
+				fetches++
+				if !tt.fetchOK {
+					return nil, somafm.ErrNetwork
+				}
+				return &somafm.Channels{Channels: testChannels(2)}, nil
+			}
+
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(tt.cached)
+			updated := now.Add(-tt.age)
+			config.LastChannelsListUpdate = updated
+
+			err := config.refreshChannels(context.Background())
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, want error %t", err, tt.err)
+			}
+			if err != nil && !errors.Is(err, somafm.ErrNetwork) {
+				t.Errorf("%v is not ErrNetwork", err)
+			}
+			if (fetches != 0) != tt.fetched {
+				t.Errorf("fetched %d times, want fetched %t", fetches, tt.fetched)
+			}
+			if got := len(config.Channels.Channels); got != tt.want {
+				t.Errorf("%d channels, want %d", got, tt.want)
+			}
+			if tt.fetched && tt.fetchOK {
+				updated = now
+			}
+			if !config.LastChannelsListUpdate.Equal(updated) {
+				t.Errorf("last update %s, want %s", config.LastChannelsListUpdate, updated)
+			}
+		})
+	}
+}
+
+func TestStateNextToConfig(t *testing.T) {
+	defer func(f string) { configFile = f }(configFile)
+	dir := t.TempDir()
+	configFile = filepath.Join(dir, "elsewhere", "soma.json")
+
+	artwork, err := newArtworkCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := historyPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := filepath.Join(dir, "elsewhere", "soma")
+	if want := filepath.Join(state, "artwork"); artwork.Dir != want {
+		t.Errorf("artwork in %s, want %s", artwork.Dir, want)
+	}
+	if filepath.Dir(history) != state {
+		t.Errorf("history in %s, want %s", history, state)
+	}
+}
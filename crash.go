@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// crashLogPath is where crash reports are kept, so that they survive the
+// terminal being cleared.
+func crashLogPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "soma", "crash.log"), nil
+}
+
+// writeCrashLog appends report to the crash log and returns its path.
+func writeCrashLog(report string) (string, error) {
+	path, err := crashLogPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "--- %s\n%s\n", time.Now().Format(time.RFC3339), report); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// recoverCrash is deferred by the goroutines soma starts beside the
+// interface. On a panic it puts the terminal back in a usable state and
+// reports the crash, see reportCrash.
+func recoverCrash(p *tea.Program) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if p != nil {
+		p.ReleaseTerminal()
+	}
+	reportCrash(r, crashReport(r, debug.Stack()))
+}
+
+// crashReport describes the panic r with the version information.
+func crashReport(r any, stack []byte) string {
+	mpvVersion := "mpv unknown"
+	if v, err := somafm.InstalledMpvVersion(); err == nil {
+		mpvVersion = v
+	}
+	logger.Error("panic", "panic", fmt.Sprint(r), "stack", string(stack))
+	return fmt.Sprintf("soma %s, %s, %s %s/%s\npanic: %v\n\n%s",
+		somaVersion(), mpvVersion, runtime.Version(), runtime.GOOS, runtime.GOARCH, r, stack)
+}
+
+// reportCrash prints the report and saves it to the crash log before
+// exiting. Set SOMA_DEBUG to re-panic instead, for the full goroutine dump.
+func reportCrash(r any, report string) {
+	fmt.Fprintln(os.Stderr, "soma crashed, sorry about that. Please report it at https://github.com/nbr23/soma/issues with the details below.")
+	if path, err := writeCrashLog(report); err == nil {
+		fmt.Fprintln(os.Stderr, "They were also saved to", path)
+	}
+	fmt.Fprintf(os.Stderr, "\n%s\n", report)
+
+	if os.Getenv("SOMA_DEBUG") != "" {
+		panic(r)
+	}
+	os.Exit(exitFailure)
+}
+
+// caughtPanic is a panic in a guardedModel, reported once bubbletea, which
+// recovers from it, has restored the terminal.
+type caughtPanic struct {
+	value  any
+	report string
+}
+
+var caught atomic.Pointer[caughtPanic]
+
+// recordPanic keeps the first panic for runProgram and passes it on to
+// bubbletea.
+func recordPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	caught.CompareAndSwap(nil, &caughtPanic{value: r, report: crashReport(r, debug.Stack())})
+	panic(r)
+}
+
+// guardedModel records the panics of a model and of the commands it returns,
+// which bubbletea runs in goroutines of its own.
+type guardedModel struct {
+	tea.Model
+}
+
+func (g guardedModel) Init() tea.Cmd {
+	defer recordPanic()
+	return guardCmd(g.Model.Init())
+}
+
+func (g guardedModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	defer recordPanic()
+	m, cmd := g.Model.Update(msg)
+	return guardedModel{m}, guardCmd(cmd)
+}
+
+func (g guardedModel) View() string {
+	defer recordPanic()
+	return g.Model.View()
+}
+
+// guardCmd records the panics of cmd and of the commands it batches.
+func guardCmd(cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		defer recordPanic()
+		msg := cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for i, c := range batch {
+				batch[i] = guardCmd(c)
+			}
+		}
+		return msg
+	}
+}
+
+// newProgram is tea.NewProgram for a model whose panics end in a crash
+// report, see runProgram.
+func newProgram(m tea.Model, options ...tea.ProgramOption) *tea.Program {
+	return tea.NewProgram(guardedModel{m}, options...)
+}
+
+// runProgram runs a program made by newProgram. bubbletea restores the
+// terminal after a panic, the crash is then reported like recoverCrash does.
+func runProgram(p *tea.Program) (tea.Model, error) {
+	final, err := p.Run()
+	if c := caught.Load(); c != nil {
+		reportCrash(c.value, c.report)
+	}
+	if g, ok := final.(guardedModel); ok {
+		final = g.Model
+	}
+	return final, err
+}
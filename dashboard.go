@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// dashboardModel is the interface of --no-mpv: the channel list with what
+// each one is playing, refreshed every whatsOnTTL, and nothing that plays.
+type dashboardModel struct {
+	ctx      context.Context
+	config   *somaConfig
+	list     list.Model
+	songs    map[string]somafm.Song
+	fetching bool
+	fetched  time.Time
+}
+
+type dashboardRefreshMsg struct{}
+
+func newDashboard(ctx context.Context, config *somaConfig) dashboardModel {
+	m := dashboardModel{ctx: ctx, config: config}
+	m.list = list.New(nil, newItemDelegate(), 0, 0)
+	m.list.Title = "SomaFM · what's on"
+	m.list.Styles.Title = titleStyle
+	m.list.SetShowPagination(config.ShowPagination)
+	m.list.SetShowStatusBar(config.ShowStatusBar)
+	m.list.SetShowHelp(config.ShowHelp)
+	m.list.InfiniteScrolling = config.WrapNavigation
+	m.list.KeyMap.Quit.SetEnabled(false)
+	m.list.Paginator.ActiveDot = paginationActiveStyle.Render("•")
+	m.list.Paginator.InactiveDot = paginationInactiveStyle.Render("•")
+	m.refreshItems()
+	return m
+}
+
+func (m *dashboardModel) refreshItems() tea.Cmd {
+	items := channelsToItems(somafm.SortChannels(m.config.Channels.Channels, m.config.SortMode, m.config.Favorites), m.config.Favorites)
+	for i, item := range items {
+		c := item.(channel)
+		if song, ok := m.songs[c.Id]; ok {
+			c.NowPlaying = song.String()
+		}
+		c.Note = m.config.Notes[c.Id]
+		items[i] = c
+	}
+	return m.list.SetItems(items)
+}
+
+func (m *dashboardModel) fetch() tea.Cmd {
+	m.fetching = true
+	m.list.NewStatusMessage(statusMessageStyle("What's on: fetching…"))
+	return fetchWhatsOn(m.ctx, m.config.Channels.Channels)
+}
+
+func (m dashboardModel) Init() tea.Cmd {
+	return func() tea.Msg { return dashboardRefreshMsg{} }
+}
+
+func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetSize(msg.Width-docStyle.GetHorizontalFrameSize(), msg.Height-docStyle.GetVerticalFrameSize())
+	case dashboardRefreshMsg:
+		if m.fetching {
+			break
+		}
+		cmd := m.fetch()
+		return m, cmd
+	case whatsOnMsg:
+		m.fetching = false
+		m.songs = msg.songs
+		m.fetched = time.Now()
+		cmd := m.refreshItems()
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("What's on: %d channels, at %s", len(msg.songs), m.fetched.Format("15:04"))))
+		next := tea.Tick(whatsOnTTL, func(time.Time) tea.Msg { return dashboardRefreshMsg{} })
+		return m, tea.Batch(cmd, next)
+	case tea.KeyMsg:
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+		switch msg.String() {
+		case "ctrl+c", "q":
+			return m, tea.Quit
+		case "w":
+			if m.fetching {
+				break
+			}
+			cmd := m.fetch()
+			return m, cmd
+		case "O":
+			c, ok := m.list.SelectedItem().(channel)
+			if !ok {
+				break
+			}
+			if err := openBrowser(c.PageURL()); err != nil {
+				m.list.NewStatusMessage(statusMessageStyle(err.Error()))
+			} else {
+				m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Opened %s", c.PageURL())))
+			}
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m dashboardModel) View() string {
+	return docStyle.Render(m.list.View())
+}
+
+// runDashboard runs the --no-mpv interface until the user quits.
+func runDashboard(ctx context.Context, config *somaConfig, options ...tea.ProgramOption) error {
+	if err := config.refreshChannels(ctx); err != nil {
+		return fmt.Errorf("unable to fetch Somafm stations: %w", err)
+	}
+	if err := config.saveConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to save config:", err)
+	}
+	p := newProgram(newDashboard(ctx, config), options...)
+	_, err := runProgram(p)
+	return err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The details panel takes a third of the height under the list, and never
+// less than detailsMinHeight lines.
+const detailsMinHeight = 6
+
+// detailsStyle separates the details panel from the list above it.
+var detailsStyle = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), true, false, false, false)
+
+// detailsHeight returns how many lines of height the details panel gets,
+// border included.
+func detailsHeight(height int) int {
+	return min(max(height/3, detailsMinHeight), height)
+}
+
+// layoutDetails sizes the details panel, and returns the height left for
+// the list.
+func (m *model) layoutDetails(width, height int) int {
+	h := detailsHeight(height)
+	if m.details.Width != width || m.details.Height != h-detailsStyle.GetVerticalFrameSize() {
+		m.details = viewport.New(width, h-detailsStyle.GetVerticalFrameSize())
+		m.detailsID = ""
+		m.refreshDetails()
+	}
+	return height - h
+}
+
+// refreshDetails shows the selected channel in the details panel, from the
+// top when the selection changed.
+func (m *model) refreshDetails() {
+	if !m.showDetails {
+		return
+	}
+	c, ok := m.selectedChannel()
+	if !ok {
+		m.details.SetContent("")
+		m.detailsID = ""
+		return
+	}
+	m.details.SetContent(channelDetails(c, m.details.Width))
+	if c.Id != m.detailsID {
+		m.details.GotoTop()
+		m.detailsID = c.Id
+	}
+}
+
+// channelDetails describes c in full, wrapped to width.
+func channelDetails(c channel, width int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", titleStyle.Render(c.ChannelTitle))
+	fmt.Fprintf(&b, "Genre: %s\n", c.Genre)
+	if c.DJ != "" {
+		fmt.Fprintf(&b, "DJ: %s\n", c.DJ)
+	}
+	fmt.Fprintf(&b, "Listeners: %d\n", c.Listeners)
+	if c.Note != "" {
+		fmt.Fprintf(&b, "Note: %s\n", c.Note)
+	}
+	if c.NowPlaying != "" {
+		fmt.Fprintf(&b, "Now playing: %s\n", c.NowPlaying)
+	}
+	fmt.Fprintf(&b, "\n%s\n\n", c.ChannelDescription)
+	if c.HighestURL != "" {
+		fmt.Fprintf(&b, "Highest: %s\n", c.HighestURL)
+	}
+	for _, u := range c.FastURL {
+		if u != "" {
+			fmt.Fprintf(&b, "Fast: %s\n", u)
+		}
+	}
+	if c.SlowURL != "" {
+		fmt.Fprintf(&b, "Slow: %s\n", c.SlowURL)
+	}
+	fmt.Fprintf(&b, "Page: %s", c.PageURL())
+	return lipgloss.NewStyle().Width(width).Render(b.String())
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// Exit codes, so that scripts can tell failures apart.
+const (
+	exitFailure         = 1
+	exitMpvUnavailable  = 2
+	exitNetwork         = 3
+	exitConfig          = 4
+	exitChannelNotFound = 5
+)
+
+var (
+	errConfigInvalid    = errors.New("invalid config")
+	errConfigUnwritable = errors.New("config not writable")
+	errMpvExited        = errors.New("mpv exited")
+	errNoTerminal       = errors.New("soma's interface needs a terminal. For scripts, use one of the headless commands such as --play-random or --update-cache (see --help).")
+	// errUsage reports bad flags, which the flag package already printed.
+	errUsage = errors.New("bad usage")
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, somafm.ErrMpvUnavailable), errors.Is(err, errMpvExited):
+		return exitMpvUnavailable
+	case errors.Is(err, somafm.ErrNetwork):
+		return exitNetwork
+	case errors.Is(err, errConfigInvalid), errors.Is(err, errConfigUnwritable):
+		return exitConfig
+	case errors.Is(err, somafm.ErrChannelNotFound), errors.Is(err, somafm.ErrAmbiguousChannel):
+		return exitChannelNotFound
+	}
+	return exitFailure
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("boom"), exitFailure},
+		{errNoTerminal, exitFailure},
+		{errUsage, exitFailure},
+		{fmt.Errorf("unable to connect to mpv: %w", somafm.ErrMpvUnavailable), exitMpvUnavailable},
+		{fmt.Errorf("%w: %w", errMpvExited, errors.New("exit status 2")), exitMpvUnavailable},
+		{fmt.Errorf("unable to fetch SomaFM stations: %w", somafm.ErrNetwork), exitNetwork},
+		{fmt.Errorf("%w: bad margin", errConfigInvalid), exitConfig},
+		{fmt.Errorf("unable to save config: %w", errConfigUnwritable), exitConfig},
+		{somafm.ErrChannelNotFound, exitChannelNotFound},
+		{somafm.ErrAmbiguousChannel, exitChannelNotFound},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%q) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+func pickRandomChannel(c []somafm.Channel, match func(somafm.Channel) bool) (*somafm.Channel, error) {
+	var candidates []somafm.Channel
+	for _, ch := range c {
+		if match(ch) {
+			candidates = append(candidates, ch)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no channel matching the given criteria")
+	}
+	return &candidates[rand.IntN(len(candidates))], nil
+}
+
+func playRandom(ctx context.Context, p *somafm.Player, config *somaConfig, genre, category string, favoritesOnly bool, quality somafm.Quality) error {
+	if err := config.refreshChannels(ctx); err != nil {
+		return fmt.Errorf("unable to fetch Somafm stations: %w", err)
+	}
+
+	categories := config.categories()
+	c, err := pickRandomChannel(config.Channels.Channels, func(ch somafm.Channel) bool {
+		if genre != "" && !strings.Contains(strings.ToLower(ch.Genre), strings.ToLower(genre)) {
+			return false
+		}
+		if category != "" && !strings.EqualFold(categories.Of(ch), category) {
+			return false
+		}
+		return !favoritesOnly || config.isFavorite(ch.Id)
+	})
+	if err != nil {
+		return err
+	}
+	return startChannel(ctx, p, config, c, quality)
+}
+
+// playChannel plays the channel the user named, see findChannel.
+func playChannel(ctx context.Context, p *somafm.Player, config *somaConfig, id string, quality somafm.Quality) error {
+	if err := config.refreshChannels(ctx); err != nil {
+		return fmt.Errorf("unable to fetch Somafm stations: %w", err)
+	}
+	c, err := config.findChannel(id)
+	if err != nil {
+		return err
+	}
+	return startChannel(ctx, p, config, c, quality)
+}
+
+// printStreamURL prints the stream behind the channel the user named, at the
+// given quality unless overridden for that channel, for use in another
+// player.
+func printStreamURL(ctx context.Context, config *somaConfig, id string, quality somafm.Quality, overrides somafm.QualityOverrides) error {
+	if err := config.refreshChannels(ctx); err != nil {
+		return fmt.Errorf("unable to fetch Somafm stations: %w", err)
+	}
+	c, err := config.findChannel(id)
+	if err != nil {
+		return err
+	}
+	if q, ok := overrides.For(*c); ok {
+		quality = q
+	}
+	u, fallback, err := c.ResolveStream(ctx, quality)
+	if err != nil {
+		return fmt.Errorf("unable to resolve the stream of %s: %w", c.Id, err)
+	}
+	if fallback != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s unreachable, using %s (%s)\n", strings.Join(fallback.Tried, ", "), fallback.URL, fallback.Got)
+	}
+	fmt.Println(u)
+	return nil
+}
+
+// startChannel starts c in mpv at the given quality, falling back to the
+// other qualities like the interface does, and records it as playing.
+func startChannel(ctx context.Context, p *somafm.Player, config *somaConfig, c *somafm.Channel, quality somafm.Quality) error {
+	if err := p.Connect(ctx); err != nil {
+		return fmt.Errorf("unable to connect to mpv: %w", err)
+	}
+	p.SetChannels(config.Channels.Channels)
+	p.SetQuality(quality)
+	if err := p.Play(ctx, c.Id); err != nil {
+		return fmt.Errorf("unable to play %s: %w", c.Id, err)
+	}
+	if f := p.Fallback(); f != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s unreachable, playing %s (%s)\n", strings.Join(f.Tried, ", "), f.URL, f.Got)
+	}
+
+	config.CurrentlyPlaying = c.Id
+	config.addRecent(c.Id)
+	config.IsPaused = false
+	if err := config.saveConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to save config:", err)
+	}
+
+	fmt.Printf("♫ Playing %s (%s)\n", c.ChannelTitle, c.Id)
+	return nil
+}
+
+func updateCache(ctx context.Context, config *somaConfig) error {
+	if err := config.updateChannels(ctx); err != nil {
+		return fmt.Errorf("unable to fetch Somafm stations: %w", err)
+	}
+	if err := config.saveConfig(); err != nil {
+		return err
+	}
+	fmt.Printf("Fetched %d channels\n", len(config.Channels.Channels))
+	return nil
+}
+
+type playbackStatus struct {
+	Socket       string `json:"socket"`
+	Channel      string `json:"channel,omitempty"`
+	ChannelTitle string `json:"channelTitle,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Paused       bool   `json:"paused"`
+	Reconnects   *int   `json:"reconnects,omitempty"`
+}
+
+func getStatus(ctx context.Context, p *somafm.Player, config *somaConfig, socketPath string) (*playbackStatus, error) {
+	if err := p.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("unable to connect to mpv: %w", err)
+	}
+	p.SetChannels(config.Channels.Channels)
+
+	status := playbackStatus{Socket: socketPath}
+	c, title, err := p.NowPlaying()
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		status.Channel = c.Id
+		status.ChannelTitle = c.ChannelTitle
+	}
+	status.Title = title
+	status.Paused, _ = p.Client().Pause()
+	if config.Diagnostics {
+		if n, ok := p.PublishedReconnects(); ok {
+			status.Reconnects = &n
+		}
+	}
+	return &status, nil
+}
+
+func printStatus(ctx context.Context, p *somafm.Player, config *somaConfig, socketPath string, asJSON bool) error {
+	status, err := getStatus(ctx, p, config, socketPath)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(status)
+	}
+
+	state := "playing"
+	if status.Paused {
+		state = "paused"
+	}
+	if status.Channel != "" {
+		fmt.Printf("Channel: %s (%s)\n", status.ChannelTitle, status.Channel)
+	} else {
+		fmt.Println("Channel: none")
+	}
+	if status.Title != "" {
+		fmt.Printf("Track:   %s\n", status.Title)
+	}
+	fmt.Printf("State:   %s\n", state)
+	if status.Reconnects != nil {
+		fmt.Printf("Reconnects: %d\n", *status.Reconnects)
+	}
+	fmt.Printf("Socket:  %s\n", status.Socket)
+	return nil
+}
+
+// shareMessage is what --share prints, as JSON with --json.
+type shareMessage struct {
+	Text         string `json:"text"`
+	Channel      string `json:"channel"`
+	ChannelTitle string `json:"channelTitle"`
+	Title        string `json:"title,omitempty"`
+	URL          string `json:"url"`
+}
+
+// printShare prints a line about what mpv is playing, ready to be posted.
+func printShare(ctx context.Context, p *somafm.Player, config *somaConfig, asJSON bool) error {
+	if err := p.Connect(ctx); err != nil {
+		return fmt.Errorf("unable to connect to mpv: %w", err)
+	}
+	p.SetChannels(config.Channels.Channels)
+	c, title, err := p.NowPlaying()
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return fmt.Errorf("nothing to share, mpv isn't playing a SomaFM channel")
+	}
+
+	share := shareMessage{Channel: c.Id, ChannelTitle: c.ChannelTitle, Title: title, URL: c.PageURL()}
+	if title != "" {
+		share.Text = fmt.Sprintf("🎧 Now playing %s on SomaFM %s — %s", title, c.ChannelTitle, share.URL)
+	} else {
+		share.Text = fmt.Sprintf("🎧 Listening to SomaFM %s — %s", c.ChannelTitle, share.URL)
+	}
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(share)
+	}
+	fmt.Println(share.Text)
+	return nil
+}
+
+// togglePause pauses or resumes the mpv on the socket. A running interface
+// follows mpv's pause state, so this doubles as its remote control.
+func togglePause(ctx context.Context, p *somafm.Player) error {
+	if err := p.Connect(ctx); err != nil {
+		return fmt.Errorf("unable to connect to mpv: %w", err)
+	}
+	paused, err := p.Client().Pause()
+	if err != nil {
+		return err
+	}
+	if err := p.Client().SetPause(!paused); err != nil {
+		return err
+	}
+	if paused {
+		fmt.Println("Playing")
+	} else {
+		fmt.Println("Paused")
+	}
+	return nil
+}
+
+// menubarStatus is the compact status printed by --menubar.
+type menubarStatus struct {
+	Running bool     `json:"running"`
+	Channel string   `json:"channel,omitempty"`
+	Title   string   `json:"title,omitempty"`
+	Paused  bool     `json:"paused"`
+	Volume  *float64 `json:"volume,omitempty"`
+}
+
+// printMenubarStatus prints a single line of JSON for menubar plugins that
+// run soma on a timer. It never starts mpv or touches the network, and mpv
+// not running is reported rather than being an error, so that polling it
+// every few seconds is cheap and quiet.
+func printMenubarStatus(ctx context.Context, p *somafm.Player, config *somaConfig, socketPath string) error {
+	var status menubarStatus
+	if s, err := getStatus(ctx, p, config, socketPath); err == nil {
+		status = menubarStatus{Running: true, Channel: s.ChannelTitle, Title: s.Title, Paused: s.Paused}
+		if v, err := p.Client().GetFloatProperty("volume"); err == nil {
+			status.Volume = &v
+		}
+	}
+	return json.NewEncoder(os.Stdout).Encode(status)
+}
+
+func clearCache() error {
+	artwork, err := newArtworkCache()
+	if err != nil {
+		return err
+	}
+	if err := artwork.Clear(); err != nil {
+		return fmt.Errorf("unable to clear %s: %s", artwork.Dir, err)
+	}
+	fmt.Printf("Cleared %s\n", artwork.Dir)
+	return nil
+}
+
+// resetCache drops the cached channel list and artwork, leaving the rest of
+// the config alone, and fetches the channels again. The cleared list is
+// saved first so that if the fetch fails the next run fetches afresh.
+func resetCache(ctx context.Context, config *somaConfig) error {
+	config.Channels = somafm.Channels{}
+	config.LastChannelsListUpdate = time.Time{}
+	if err := config.saveConfig(); err != nil {
+		return err
+	}
+	if err := clearCache(); err != nil {
+		return err
+	}
+	return updateCache(ctx, config)
+}
+
+// setFavorite adds the channel named by id to the favorites, or removes it.
+// A favorite is removed by its id as is, even if SomaFM dropped the channel
+// since it was added.
+func setFavorite(ctx context.Context, config *somaConfig, id string, favorite bool) error {
+	if !favorite && config.isFavorite(id) {
+		config.removeFavorite(id)
+		if err := config.saveConfig(); err != nil {
+			return err
+		}
+		name := id
+		if c, ok := config.Channels.Find(id); ok {
+			name = fmt.Sprintf("%s (%s)", c.ChannelTitle, c.Id)
+		}
+		fmt.Printf("%s removed from favorites\n", name)
+		return nil
+	}
+
+	if err := config.refreshChannels(ctx); err != nil {
+		return fmt.Errorf("unable to fetch Somafm stations: %w", err)
+	}
+	c, err := config.findChannel(id)
+	if err != nil {
+		return err
+	}
+
+	if favorite {
+		config.addFavorite(c.Id)
+	} else {
+		config.removeFavorite(c.Id)
+	}
+	if err := config.saveConfig(); err != nil {
+		return err
+	}
+
+	if favorite {
+		fmt.Printf("★ %s (%s) added to favorites\n", c.ChannelTitle, c.Id)
+	} else {
+		fmt.Printf("%s (%s) removed from favorites\n", c.ChannelTitle, c.Id)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+func TestSetFavorite(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		favorite bool
+		want     []string
+		err      error
+	}{
+		{"add", "chan2", true, []string{"chan1", "gone", "chan2"}, nil},
+		{"add by title", "Channel 2", true, []string{"chan1", "gone", "chan2"}, nil},
+		{"add dropped channel", "gone", true, []string{"chan1", "gone"}, somafm.ErrChannelNotFound},
+		{"remove", "chan1", false, []string{"gone"}, nil},
+		{"remove by title", "Channel 1", false, []string{"gone"}, nil},
+		{"remove dropped channel", "gone", false, []string{"chan1"}, nil},
+		{"remove unknown", "nope", false, []string{"chan1", "gone"}, somafm.ErrChannelNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(f string) { configFile = f }(configFile)
+			configFile = filepath.Join(t.TempDir(), "soma.json")
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(3)
+			config.LastChannelsListUpdate = time.Now()
+			config.Favorites = []string{"chan1", "gone"}
+
+			err := setFavorite(context.Background(), config, tt.query, tt.favorite)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if !slices.Equal(config.Favorites, tt.want) {
+				t.Errorf("favorites %q, want %q", config.Favorites, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// helpMinHeight is the terminal height under which the help footer is
+// hidden, to leave its lines to the channels.
+const helpMinHeight = 15
+
+// actionHelp is the help text of the actions listed in the help footer.
+type actionHelp struct {
+	action, desc string
+}
+
+// shortHelp is added to the one line help, fullHelp to the full help that ?
+// toggles. The README has every key.
+var (
+	shortHelp = []actionHelp{{"pause", "pause"}, {"favorite", "favorite"}}
+	fullHelp  = []actionHelp{
+		{"pause", "pause"},
+		{"favorite", "favorite"},
+		{"favoritesView", "favorites"},
+		{"search", "search"},
+		{"next", "next"},
+		{"previous", "previous"},
+		{"details", "details"},
+		{"whatsOn", "what's on"},
+		{"switcher", "switcher"},
+		{"toggleHelp", "hide help"},
+	}
+)
+
+// enterHelp leads the help, enter can't be rebound.
+var enterHelp = key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "play"))
+
+// bindings returns the help of enter and the actions, on the keys they are
+// bound to.
+func (km keymap) bindings(actions []actionHelp) []key.Binding {
+	bindings := []key.Binding{enterHelp}
+	for _, a := range actions {
+		k := km.key(a.action)
+		bindings = append(bindings, key.NewBinding(key.WithKeys(k), key.WithHelp(keyName(k), a.desc)))
+	}
+	return bindings
+}
+
+// keyName spells out the keys that don't show in the help.
+func keyName(k string) string {
+	if k == " " {
+		return "space"
+	}
+	return k
+}
+
+// setupHelp lists soma's own keys in the list's help footer, and moves the
+// list's quit key along with soma's.
+func setupHelp(l *list.Model, km keymap) {
+	quit := km.key("quit")
+	l.KeyMap.Quit = key.NewBinding(key.WithKeys(quit), key.WithHelp(keyName(quit), "quit"))
+	l.AdditionalShortHelpKeys = func() []key.Binding { return km.bindings(shortHelp) }
+	l.AdditionalFullHelpKeys = func() []key.Binding { return km.bindings(fullHelp) }
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// historyEntry is a line of history.jsonl, written on each track change.
+// Playback events, such as falling back on another stream than the
+// preferred one, are logged too, with Event set.
+type historyEntry struct {
+	Time    time.Time      `json:"time"`
+	Channel string         `json:"channel"`
+	Title   string         `json:"title,omitempty"`
+	Event   string         `json:"event,omitempty"`
+	Wanted  somafm.Quality `json:"wanted,omitempty"`
+	Got     somafm.Quality `json:"got,omitempty"`
+	Tried   []string       `json:"tried,omitempty"`
+	URL     string         `json:"url,omitempty"`
+}
+
+// retention bounds an append-only JSON lines file: entries beyond the
+// newest MaxEntries, or older than MaxAge, are dropped. Zero means no limit.
+type retention struct {
+	MaxEntries int
+	MaxAge     time.Duration
+}
+
+func historyPath() (string, error) {
+	configPath, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "soma", "history.jsonl"), nil
+}
+
+func (c *somaConfig) historyRetention() retention {
+	return retention{
+		MaxEntries: c.HistoryMaxEntries,
+		MaxAge:     time.Duration(c.HistoryMaxDays) * 24 * time.Hour,
+	}
+}
+
+// appendJSONLine appends v to the JSON lines file at path.
+func appendJSONLine(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(v)
+}
+
+// rotateJSONLines applies r to the JSON lines file at path, whose entries
+// carry their date in a "time" field. Lines that don't parse are dropped.
+// The file is rewritten through a temporary file so that a crash can't
+// truncate it.
+func rotateJSONLines(path string, r retention) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var kept [][]byte
+	cutoff := time.Now().Add(-r.MaxAge)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// No line is longer than the file, whatever the track titles.
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		var entry struct {
+			Time time.Time `json:"time"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if r.MaxAge > 0 && entry.Time.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, bytes.Clone(scanner.Bytes()))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if r.MaxEntries > 0 && len(kept) > r.MaxEntries {
+		kept = kept[len(kept)-r.MaxEntries:]
+	}
+
+	var out bytes.Buffer
+	for _, line := range kept {
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if bytes.Equal(out.Bytes(), data) {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateJSONLines(t *testing.T) {
+	now := time.Now()
+	line := func(age time.Duration, title string) string {
+		return fmt.Sprintf(`{"time":%q,"title":%q}`, now.Add(-age).Format(time.RFC3339), title)
+	}
+	long := strings.Repeat("x", 100*1024)
+	tests := []struct {
+		name  string
+		lines []string
+		r     retention
+		want  []string
+	}{
+		{
+			name:  "keep all",
+			lines: []string{line(time.Hour, "a"), line(0, "b")},
+			want:  []string{line(time.Hour, "a"), line(0, "b")},
+		},
+		{
+			name:  "max entries",
+			lines: []string{line(2*time.Hour, "a"), line(time.Hour, "b"), line(0, "c")},
+			r:     retention{MaxEntries: 2},
+			want:  []string{line(time.Hour, "b"), line(0, "c")},
+		},
+		{
+			name:  "max age",
+			lines: []string{line(48*time.Hour, "a"), line(time.Hour, "b")},
+			r:     retention{MaxAge: 24 * time.Hour},
+			want:  []string{line(time.Hour, "b")},
+		},
+		{
+			name:  "bad line",
+			lines: []string{"not json", line(0, "b")},
+			want:  []string{line(0, "b")},
+		},
+		{
+			name:  "long line",
+			lines: []string{line(time.Hour, long), line(0, "b")},
+			r:     retention{MaxEntries: 5},
+			want:  []string{line(time.Hour, long), line(0, "b")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history.jsonl")
+			if err := os.WriteFile(path, []byte(strings.Join(tt.lines, "\n")+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := rotateJSONLines(path, tt.r); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(data), strings.Join(tt.want, "\n")+"\n"; got != want {
+				t.Errorf("got %.200q, want %.200q", got, want)
+			}
+		})
+	}
+}
+
+func TestRotateJSONLinesMissingFile(t *testing.T) {
+	if err := rotateJSONLines(filepath.Join(t.TempDir(), "none.jsonl"), retention{MaxEntries: 1}); err != nil {
+		t.Error(err)
+	}
+}
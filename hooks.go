@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// splitCommand splits a command line into arguments, honoring single and
+// double quotes.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// runHook starts a user command such as OnTrackChange without waiting for
+// it. Placeholders are substituted in each argument after
+// splitting and the command doesn't go through a shell, so a track title
+// can't inject anything. The values are also exported as SOMA_* environment
+// variables, for hooks that do need a shell.
+func runHook(template string, c *somafm.Channel, title string) {
+	if template == "" || c == nil {
+		return
+	}
+	args, err := splitCommand(template)
+	if err != nil || len(args) == 0 {
+		logger.Error("hook", "command", template, "error", err)
+		return
+	}
+
+	r := strings.NewReplacer(
+		"{channel}", c.ChannelTitle,
+		"{id}", c.Id,
+		"{genre}", c.Genre,
+		"{title}", title,
+	)
+	for i := range args {
+		args[i] = r.Replace(args[i])
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"SOMA_CHANNEL="+c.ChannelTitle,
+		"SOMA_ID="+c.Id,
+		"SOMA_GENRE="+c.Genre,
+		"SOMA_TITLE="+title,
+	)
+	if err := cmd.Start(); err != nil {
+		logger.Error("hook", "command", args, "error", err)
+		return
+	}
+	logger.Debug("hook", "command", args)
+	go cmd.Wait()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// defaultKeys maps each action that can be rebound with "keys" in the
+// config to its default key.
+var defaultKeys = map[string]string{
+	"quit":             "q",
+	"pause":            " ",
+	"volumeUp":         "+",
+	"volumeDown":       "-",
+	"togglePagination": "P",
+	"toggleStatusBar":  "S",
+	"toggleHelp":       "H",
+	"qualityHighest":   "1",
+	"qualityFast":      "2",
+	"qualitySlow":      "3",
+	"favorite":         "f",
+	"favoritesView":    "F",
+	"moveFavoriteUp":   "K",
+	"moveFavoriteDown": "J",
+	"next":             "n",
+	"previous":         "p",
+	"sort":             "o",
+	"cacheLess":        "[",
+	"cacheMore":        "]",
+	"clock":            "t",
+	"groupByGenre":     "v",
+	"category":         "c",
+	"search":           "s",
+	"whatsOn":          "w",
+	"refresh":          "R",
+	"note":             "N",
+	"queue":            "u",
+	"details":          "i",
+	"detailsUp":        "{",
+	"detailsDown":      "}",
+	"openPage":         "O",
+	"audioDevice":      "a",
+	"mpvLog":           "L",
+	"switcher":         "tab",
+	"recent":           "r",
+	"sampler":          "e",
+}
+
+// reservedKeys can't be bound to an action.
+var reservedKeys = []string{"ctrl+c", "enter", "esc"}
+
+// listKeys are the keys the channel list browses with, which actions can't
+// be bound to, unless it is the default key of one that already shadows the
+// list's, such as f.
+var listKeys = func() []string {
+	km := list.DefaultKeyMap()
+	var keys []string
+	for _, b := range []key.Binding{km.CursorUp, km.CursorDown, km.PrevPage, km.NextPage,
+		km.GoToStart, km.GoToEnd, km.Filter, km.ShowFullHelp} {
+		keys = append(keys, b.Keys()...)
+	}
+	return keys
+}()
+
+// keyNames are the names bubbletea gives the keys that aren't characters,
+// such as tab or ctrl+left.
+var keyNames = func() map[string]bool {
+	names := map[string]bool{}
+	for t := tea.KeyType(-128); t < 128; t++ {
+		if name := (tea.Key{Type: t}).String(); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// knownKey tells whether key is one bubbletea reports, a character or a key
+// name, with or without alt.
+func knownKey(key string) bool {
+	key = strings.TrimPrefix(key, "alt+")
+	return utf8.RuneCountInString(key) == 1 || keyNames[key]
+}
+
+// isDefaultKey tells whether key is the default key of an action.
+func isDefaultKey(key string) bool {
+	for _, k := range defaultKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// keymap maps the keys pressed to the default key of the action they are
+// bound to, so that Update only deals with default keys. Keys whose action
+// was moved elsewhere map to "", and go to the list as if never bound.
+type keymap map[string]string
+
+// newKeymap applies the overrides, keyed by action, to the default keys.
+// Two actions on the same key is an error, and so are keys that can't be
+// pressed or that the list browses with.
+func newKeymap(overrides map[string]string) (keymap, error) {
+	actions := make([]string, 0, len(defaultKeys))
+	for action := range defaultKeys {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	for action, key := range overrides {
+		if _, ok := defaultKeys[action]; !ok {
+			return nil, fmt.Errorf("keys: unknown action %q", action)
+		}
+		if key == "" || slices.Contains(reservedKeys, key) {
+			return nil, fmt.Errorf("keys: %q can't be bound to %s", key, action)
+		}
+		if !knownKey(key) {
+			return nil, fmt.Errorf("keys: unknown key %q for %s", key, action)
+		}
+		if slices.Contains(listKeys, key) && !isDefaultKey(key) {
+			return nil, fmt.Errorf("keys: %q moves around the list, it can't be bound to %s", key, action)
+		}
+	}
+
+	km := keymap{}
+	bound := map[string]string{}
+	for _, action := range actions {
+		key, ok := overrides[action]
+		if !ok {
+			key = defaultKeys[action]
+		}
+		if other, ok := bound[key]; ok {
+			return nil, fmt.Errorf("keys: %q is bound to both %s and %s", key, other, action)
+		}
+		bound[key] = action
+		if key != defaultKeys[action] {
+			km[key] = defaultKeys[action]
+			if _, ok := km[defaultKeys[action]]; !ok {
+				km[defaultKeys[action]] = ""
+			}
+		}
+	}
+	return km, nil
+}
+
+// translate returns the default key of the action bound to key.
+func (km keymap) translate(key string) string {
+	if k, ok := km[key]; ok {
+		return k
+	}
+	return key
+}
+
+// key returns the key action is bound to.
+func (km keymap) key(action string) string {
+	def := defaultKeys[action]
+	for k, d := range km {
+		if d == def {
+			return k
+		}
+	}
+	return def
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewKeymap(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		err       string
+	}{
+		{name: "defaults"},
+		{name: "free key", overrides: map[string]string{"favorite": "z"}},
+		{name: "key name", overrides: map[string]string{"details": "ctrl+left"}},
+		{name: "alt key", overrides: map[string]string{"details": "alt+x"}},
+		{name: "function key", overrides: map[string]string{"details": "f5"}},
+		{name: "control key", overrides: map[string]string{"details": "ctrl+x"}},
+		{name: "swapped", overrides: map[string]string{"next": "p", "previous": "n"}},
+		{name: "default key of a moved action", overrides: map[string]string{"favorite": "z", "queue": "f"}},
+		{name: "unknown action", overrides: map[string]string{"dance": "z"}, err: `unknown action "dance"`},
+		{name: "empty", overrides: map[string]string{"favorite": ""}, err: `"" can't be bound`},
+		{name: "reserved", overrides: map[string]string{"favorite": "enter"}, err: `"enter" can't be bound`},
+		{name: "unknown key", overrides: map[string]string{"favorite": "space"}, err: `unknown key "space"`},
+		{name: "misspelled key name", overrides: map[string]string{"favorite": "ctrl+lft"}, err: `unknown key "ctrl+lft"`},
+		{name: "filter", overrides: map[string]string{"search": "/"}, err: `"/" moves around the list`},
+		{name: "cursor", overrides: map[string]string{"favorite": "j"}, err: `"j" moves around the list`},
+		{name: "arrow", overrides: map[string]string{"next": "right"}, err: `"right" moves around the list`},
+		{name: "page", overrides: map[string]string{"next": "pgdown"}, err: `"pgdown" moves around the list`},
+		{name: "end", overrides: map[string]string{"next": "G"}, err: `"G" moves around the list`},
+		{name: "help", overrides: map[string]string{"toggleHelp": "?"}, err: `"?" moves around the list`},
+		{name: "taken", overrides: map[string]string{"favorite": "F"}, err: `"F" is bound to both`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newKeymap(tt.overrides)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestKeymapTranslate(t *testing.T) {
+	km, err := newKeymap(map[string]string{"favorite": "z", "next": "p", "previous": "n", "quit": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pressed, want string
+	}{
+		{"z", "f"},
+		// f is left to the list, which pages with it.
+		{"f", ""},
+		{"p", "n"},
+		{"n", "p"},
+		{"x", "q"},
+		{"q", ""},
+		{"o", "o"},
+		{"j", "j"},
+	}
+	for _, tt := range tests {
+		if got := km.translate(tt.pressed); got != tt.want {
+			t.Errorf("translate(%q) = %q, want %q", tt.pressed, got, tt.want)
+		}
+	}
+
+	actions := []struct {
+		action, want string
+	}{
+		{"favorite", "z"},
+		{"next", "p"},
+		{"quit", "x"},
+		{"sort", "o"},
+	}
+	for _, tt := range actions {
+		if got := km.key(tt.action); got != tt.want {
+			t.Errorf("key(%q) = %q, want %q", tt.action, got, tt.want)
+		}
+	}
+}
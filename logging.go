@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// setupJSONLogging appends debug level JSON logs to the file at path, from
+// both soma and the somafm package.
+func setupJSONLogging(path string) (io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	logger = slog.New(slog.NewJSONHandler(f, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	somafm.SetLogger(logger)
+	return f, nil
+}
+
+// logLevels are the values logLevel takes in the config.
+var logLevels = map[string]slog.Level{
+	"error": slog.LevelError,
+	"warn":  slog.LevelWarn,
+	"info":  slog.LevelInfo,
+	"debug": slog.LevelDebug,
+}
+
+// verbosity counts the -v flags given.
+type verbosity int
+
+func (v *verbosity) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+func (v *verbosity) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if on {
+		*v++
+	} else {
+		*v = 0
+	}
+	return nil
+}
+
+func (v *verbosity) IsBoolFlag() bool {
+	return true
+}
+
+// interfaceLogPath is where logs go while the interface runs, as it draws
+// over stderr: soma.log in the cache directory, next to crash.log.
+func interfaceLogPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "soma")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "soma.log"), nil
+}
+
+// setupLogging logs to the file at path, or stderr, from the configured
+// level, one level more detailed per -v. Without a configured level, -v logs
+// from info and -v -v everything, and nothing is logged without -v.
+func setupLogging(configured string, verbose verbosity, path string) (*os.File, error) {
+	level, ok := logLevels[configured]
+	if !ok && verbose == 0 {
+		return nil, nil
+	}
+	if !ok {
+		level = slog.LevelWarn
+	}
+	level = max(level-slog.Level(4*verbose), slog.LevelDebug)
+
+	var f *os.File
+	var out io.Writer = os.Stderr
+	if path != "" {
+		var err error
+		if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			return nil, fmt.Errorf("unable to open log file: %w", err)
+		}
+		out = f
+	}
+	logger = slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: level}))
+	somafm.SetLogger(logger)
+	return f, nil
+}
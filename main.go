@@ -1,469 +1,416 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"encoding/xml"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
+	"io/fs"
 	"os"
-	"os/exec"
-	"os/signal"
 	"path/filepath"
-	"syscall"
+	"runtime/debug"
 	"time"
 
-	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
 
-	mpv "github.com/nbr23/go-mpv"
-	"golang.org/x/net/html/charset"
+	"github.com/nbr23/soma/somafm"
 )
 
-/* XML PARSING */
-
-type channel struct {
-	ChannelTitle       string   `xml:"title" json:"title"`
-	HighestURL         string   `xml:"highestpls" json:"highestpls"`
-	FastURL            []string `xml:"fastpls" json:"fastpls"`
-	SlowURL            string   `xml:"slowpls" json:"slowpls"`
-	Id                 string   `xml:"id,attr" json:"id"`
-	ChannelDescription string   `xml:"description" json:"description"`
-	Genre              string   `xml:"genre" json:"genre"`
-	IsPlaying          *bool
-}
-
-func (c channel) FilterValue() string {
-	return fmt.Sprintf("%s %s", c.Id, c.ChannelDescription)
-}
-func (c channel) Title() string {
-	if *c.IsPlaying {
-		return fmt.Sprintf("♫ %s", c.ChannelTitle)
+// defaultSocketPath returns a per-user mpv socket path, so that users sharing
+// a machine don't step on each other's mpv.
+func defaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "soma-mpv.sock")
 	}
-	return c.ChannelTitle
+	if os.Getuid() != -1 {
+		return filepath.Join(tempSocketDir(), "mpv.sock")
+	}
+	return filepath.Join(os.TempDir(), "soma-mpv.sock")
 }
-func (c channel) Description() string { return fmt.Sprintf("%s | %s", c.Genre, c.ChannelDescription) }
 
-type channels struct {
-	Channels []channel `xml:"channel" json:"channels"`
+// tempSocketDir is the per-user socket directory without XDG_RUNTIME_DIR.
+func tempSocketDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("soma-%d", os.Getuid()))
 }
 
-func getSomaChannels() (*channels, error) {
-	res, err := http.Get("https://somafm.com/channels.xml")
-	if err != nil {
-		return nil, err
-	}
-
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+// checkTempSocketDir refuses a socket in tempSocketDir that isn't the user's
+// own, even just to connect: anyone can create it first in the shared temp
+// directory. mpv creates it when missing.
+func checkTempSocketDir(path string) error {
+	dir := filepath.Dir(path)
+	if os.Getuid() == -1 || dir != tempSocketDir() {
+		return nil
 	}
-
-	var c channels
-
-	reader := bytes.NewReader(body)
-	decoder := xml.NewDecoder(reader)
-	decoder.CharsetReader = charset.NewReaderLabel
-	err = decoder.Decode(&c)
-	if err != nil {
-		return nil, err
+	if err := somafm.CheckSocketDir(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", somafm.ErrMpvUnavailable, err)
 	}
-
-	return &c, nil
-}
-
-/* TUI */
-
-var (
-	docStyle           = lipgloss.NewStyle().Margin(1, 1)
-	statusMessageStyle = lipgloss.NewStyle().
-				Foreground(lipgloss.Color("#00FF00")).
-				Render
-	titleStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FFFDF5")).
-			Bold(true)
-
-	paginationActiveStyle = lipgloss.NewStyle().
-				Foreground(lipgloss.Color("#00AA00")).
-				Bold(true)
-	paginationInactiveStyle = lipgloss.NewStyle().
-				Foreground(lipgloss.Color("#909090"))
-
-	cursorStyle = lipgloss.NewStyle().
-			Bold(true).
-			Padding(0, 0, 0, 1).
-			Foreground(lipgloss.Color("#00FF00"))
-)
-
-type model struct {
-	playing   string
-	mpvConfig *mpvConfig
-	quitting  bool
-	config    *somaConfig
-	list      list.Model
-}
-
-type currentTitleUpdateMsg struct {
-	title string
+	return nil
 }
 
-type changePausedStatusMsg struct {
-	paused bool
+func somaVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
 }
 
-func newItemDelegate() list.DefaultDelegate {
-	d := list.NewDefaultDelegate()
-	d.Styles.SelectedTitle = cursorStyle
-	d.Styles.SelectedDesc = cursorStyle
-	d.SetSpacing(0)
-
-	return d
+func printVersion() {
+	fmt.Printf("soma %s\n", somaVersion())
+	if v, err := somafm.InstalledMpvVersion(); err == nil {
+		fmt.Println(v)
+	} else {
+		fmt.Println("mpv not found:", err)
+	}
 }
 
-func channelsToItems(c []channel) []list.Item {
-	items := make([]list.Item, len(c))
-	for i, ch := range c {
-		ch.IsPlaying = new(bool)
-		items[i] = ch
+// streamQuality returns the quality named by --quality, which applies to
+// every channel, or the configured ones.
+func streamQuality(config *somaConfig, flag string) (somafm.Quality, somafm.QualityOverrides, error) {
+	if flag == "" {
+		return config.PreferredQuality, config.qualityOverrides(), nil
 	}
-	return items
+	q, err := somafm.ParseQuality(flag)
+	return q, somafm.QualityOverrides{}, err
 }
 
-func setIsPlaying(l list.Model, id string, isPlaying bool) {
-	for _, c := range l.Items() {
-		if c.(channel).Id == id {
-			*c.(channel).IsPlaying = isPlaying
-		} else {
-			*c.(channel).IsPlaying = false
+func main() {
+	if err := run(); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, err)
 		}
+		os.Exit(exitCode(err))
 	}
 }
 
-func initialModel(m *mpvConfig) model {
-	model := model{
-		playing:   "",
-		mpvConfig: m,
-		quitting:  false,
+// run runs soma and returns why it failed, for main to report with the
+// matching exit code.
+func run() error {
+	flags := flag.NewFlagSet("soma", flag.ContinueOnError)
+	socketPath := flags.String("socket", defaultSocketPath(), "Path to mpv socket")
+	flags.StringVar(&configFile, "config", "", "Path to the config file (default: soma.json in the user config directory)")
+	startMpv := flags.Bool("start-mpv", true, "Start mpv if not running")
+	mpvLog := flags.String("mpv-log", "", "Append the output of the mpv soma starts to this file")
+	mpvStartTimeout := flags.Duration("mpv-start-timeout", 5*time.Second, "How long to wait for a started mpv to come up")
+	play := flags.String("play", "", "Play the channel with this id and exit")
+	playRandomFlag := flags.Bool("play-random", false, "Play a random channel and exit")
+	qualityFlag := flags.String("quality", "", "Stream quality for --play, --play-random and --url: highest, fast or slow")
+	genre := flags.String("genre", "", "Restrict --play-random to channels matching this genre")
+	category := flags.String("category", "", "Restrict --play-random to channels in this category, such as ambient or electronic")
+	favoritesOnly := flags.Bool("favorites", false, "Restrict --play-random to favorite channels")
+	urlFlag := flags.String("url", "", "Print the stream URL of the channel with this id and exit")
+	favorite := flags.String("favorite", "", "Add the channel with this id to favorites and exit")
+	unfavorite := flags.String("unfavorite", "", "Remove the channel with this id from favorites and exit")
+	updateCacheFlag := flags.Bool("update-cache", false, "Refresh the cached channel list and exit")
+	versionFlag := flags.Bool("version", false, "Print soma and mpv versions and exit")
+	clearCacheFlag := flags.Bool("clear-cache", false, "Delete cached channel artwork and exit")
+	exportFlag := flags.String("export", "", "Write favorites, aliases, notes and preferences to this file and exit")
+	importFlag := flags.String("import", "", "Merge favorites, aliases, notes and presets from a file written by --export and exit")
+	force := flags.Bool("force", false, "Make --import replace the local settings instead of merging")
+	resetCacheFlag := flags.Bool("reset-cache", false, "Delete the cached channel list and artwork, fetch the channels again and exit")
+	togglePauseFlag := flags.Bool("toggle-pause", false, "Pause or resume mpv and exit, e.g. from a global hotkey")
+	statusFlag := flags.Bool("status", false, "Print what mpv is playing and exit")
+	shareFlag := flags.Bool("share", false, "Print a line about what's playing, to post it somewhere, and exit")
+	barFlag := flags.Bool("bar", false, "Print a status line on each playback change, e.g. for tmux")
+	jsonFlag := flags.Bool("json", false, "Print --status and --share as JSON")
+	menubar := flags.Bool("menubar", false, "Print a one-line JSON status for menubar plugins and exit")
+	logJSON := flags.String("log-json", "", "Write debug logs as JSON to this file")
+	logFile := flags.String("log-file", "", "Write the logs enabled with -v or logLevel to this file instead of stderr, or soma.log in the cache directory for the interface")
+	var verbose verbosity
+	flags.Var(&verbose, "v", "Log to stderr, or a file for the interface (see --log-file), more with each -v: -v for info, -v -v for debug")
+	flags.Var(&verbose, "verbose", "Same as -v")
+	preset := flags.String("preset", "", "Start with the channels of this preset from the config")
+	sortFlag := flags.String("sort", "", "Sort order: default, title, genre, listeners or favorites, or several separated by commas")
+	themeFlag := flags.String("theme", "", "Color theme: default or high-contrast")
+	detach := flags.Bool("detach", false, "Leave mpv playing when quitting")
+	noSetup := flags.Bool("no-setup", false, "Skip the first-run setup")
+	mouse := flags.Bool("mouse", true, "Click to select and play channels; --mouse=false keeps the terminal's text selection")
+	untilEnd := flags.Bool("play-until-end", false, "Quit the interface when the playing stream ends, e.g. for one-off specials")
+	noMpv := flags.Bool("no-mpv", false, "Show what every channel is playing, without mpv or any playback")
+	rotateFavorites := flags.Bool("rotate-favorites", false, "Start playing the favorites in turn, samplerSeconds each, until a channel is picked")
+	liteFlag := flags.Bool("lite", false, "One line per channel, no colors and fewer redraws, e.g. over a slow SSH link")
+	webAddr := flags.String("web-addr", "", "Serve a web page and JSON API to control soma on this address, e.g. 8080 for localhost or 0.0.0.0:8080 for the network")
+	inline := flags.Bool("inline", true, "Draw the interface in the terminal; --inline=false uses the alternate screen and restores the scrollback on exit")
+	if err := flags.Parse(os.Args[1:]); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return errUsage
 	}
 
-	config, _ := loadConfig()
-	model.config = config
+	if *versionFlag {
+		printVersion()
+		return nil
+	}
+	if err := checkTempSocketDir(*socketPath); err != nil {
+		return err
+	}
 
-	if len(model.config.Channels.Channels) == 0 || time.Since(model.config.LastChannelsListUpdate) > 24*time.Hour*7 {
-		model.config.LastChannelsListUpdate = time.Now()
-		c, err := getSomaChannels()
+	if *logJSON != "" {
+		f, err := setupJSONLogging(*logJSON)
 		if err != nil {
-			fmt.Println("Unable to fetch Somafm stations", err)
-			os.Exit(1)
+			return fmt.Errorf("unable to open log file: %w", err)
 		}
-		model.config.Channels = *c
+		defer f.Close()
 	}
 
-	model.list = list.New(channelsToItems(model.config.Channels.Channels), newItemDelegate(), 0, 0)
-	model.list.Title = "SomaFM"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	mpvCurrentlyPlayingPath, err := m.mpv.Path()
-	if err != nil {
-		panic(err)
-	}
-	if mpvCurrentlyPlayingPath != "" {
-		for i, c := range model.config.Channels.Channels {
-			if c.HighestURL == mpvCurrentlyPlayingPath {
-				model.playing = c.Id
-				model.mpvConfig.mpv.SetPause(model.config.IsPaused)
-				model.list.Select(i)
-				setIsPlaying(model.list, c.Id, model.config.IsPaused)
-				break
-			}
-		}
-		if model.playing == "" {
-			model.mpvConfig.mpv.SetPause(true)
+	checkConfigWritable()
+	config, err := loadConfig()
+	firstRun := errors.Is(err, fs.ErrNotExist)
+	if errors.Is(err, errConfigInvalid) {
+		return err
+	}
+
+	// --log-json, for bug reports, logs everything already.
+	if *logJSON == "" {
+		f, err := setupLogging(config.LogLevel, verbose, *logFile)
+		if err != nil {
+			return err
 		}
-	} else {
-		if model.config.CurrentlyPlaying != "" {
-			for i, c := range model.config.Channels.Channels {
-				if c.Id == model.config.CurrentlyPlaying {
-					model.list.Select(i)
-					if !model.config.IsPaused {
-						model.playing = c.Id
-						model.mpvConfig.mpv.Loadfile(c.HighestURL, mpv.LoadFileModeReplace)
-						setIsPlaying(model.list, c.Id, true)
-					}
-					break
-				}
-			}
+		if f != nil {
+			defer f.Close()
 		}
 	}
 
-	return model
-}
-
-func (m model) Init() tea.Cmd {
-	return nil
-}
-
-func (m *model) PlaySelectedChannel() {
-	m.playing = m.list.SelectedItem().(channel).Id
-	m.mpvConfig.mpv.Loadfile(m.list.SelectedItem().(channel).HighestURL, mpv.LoadFileModeReplace)
-	m.config.CurrentlyPlaying = m.list.SelectedItem().(channel).Id
-}
-
-func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.WindowSizeMsg:
-		top, right, bottom, left := docStyle.GetMargin()
-		m.list.SetSize(msg.Width-left-right, msg.Height-top-bottom)
-	case currentTitleUpdateMsg:
-		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("♫ Now playing: « %s | %s »", m.list.SelectedItem().(channel).ChannelTitle, msg.title)))
-	case changePausedStatusMsg:
-		if msg.paused {
-			setIsPlaying(m.list, m.playing, false)
-			m.config.IsPaused = true
-			m.playing = ""
-			m.list.NewStatusMessage("")
-		} else {
-			m.config.IsPaused = false
-			m.playing = m.config.CurrentlyPlaying
-			setIsPlaying(m.list, m.playing, true)
-			title, _ := m.mpvConfig.mpv.GetProperty("media-title")
-			m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("♫ Now playing: « %s | %s »", m.config.CurrentlyPlaying, title)))
+	if *updateCacheFlag {
+		return updateCache(ctx, config)
+	}
 
+	if *urlFlag != "" {
+		quality, overrides, err := streamQuality(config, *qualityFlag)
+		if err != nil {
+			return err
 		}
-	case tea.KeyMsg:
-		switch msg.String() {
-
-		case "ctrl+c", "q":
-			m.config.saveConfig()
-			m.quitting = true
-			if m.mpvConfig.signals != nil {
-				m.mpvConfig.signals <- somaStopSignal{}
-			} else {
-				m.mpvConfig.mpv.SetPause(true)
-			}
-			return m, tea.Quit
+		return printStreamURL(ctx, config, *urlFlag, quality, overrides)
+	}
 
-		case "enter":
-			if m.list.FilterState() == list.Filtering {
-				return m, nil
-			}
-			if m.playing != m.list.SelectedItem().(channel).Id {
-				m.PlaySelectedChannel()
-				setIsPlaying(m.list, m.list.SelectedItem().(channel).Id, true)
-				m.config.IsPaused = false
-				m.playing = m.list.SelectedItem().(channel).Id
-				if paused, _ := m.mpvConfig.mpv.Pause(); paused {
-					m.mpvConfig.mpv.SetPause(false)
-				}
-			} else {
-				setIsPlaying(m.list, m.playing, false)
-				m.mpvConfig.mpv.SetPause(true)
-				m.config.IsPaused = true
-				m.playing = ""
-				m.list.NewStatusMessage("")
-			}
+	if *favorite != "" || *unfavorite != "" {
+		id, add := *favorite, true
+		if id == "" {
+			id, add = *unfavorite, false
 		}
+		return setFavorite(ctx, config, id, add)
 	}
-	var cmd tea.Cmd
-	m.list, cmd = m.list.Update(msg)
-	return m, cmd
-}
 
-func (m model) View() string {
-	if m.quitting {
-		return ""
+	if *clearCacheFlag {
+		return clearCache()
 	}
-	return docStyle.Render(m.list.View())
-}
 
-/* MPV */
+	if *exportFlag != "" {
+		return exportConfig(config, *exportFlag)
+	}
 
-type mpvConfig struct {
-	socketPath string
-	startMpv   bool
-	signals    chan os.Signal
-	mpv        *mpv.Client
-	ipccClient *mpv.IPCClient
-}
+	if *importFlag != "" {
+		return importConfig(config, *importFlag, *force)
+	}
 
-type somaStopSignal struct{}
+	if *resetCacheFlag {
+		return resetCache(ctx, config)
+	}
 
-func (s somaStopSignal) Signal()        {}
-func (s somaStopSignal) String() string { return "somaStopSignal" }
+	if *togglePauseFlag {
+		return togglePause(ctx, somafm.NewPlayer(*socketPath, false))
+	}
 
-func runMpv(c *mpvConfig) error {
-	cmd := exec.Command("mpv", "--idle", fmt.Sprintf("--input-ipc-server=%s", c.socketPath))
+	if *statusFlag {
+		return printStatus(ctx, somafm.NewPlayer(*socketPath, false), config, *socketPath, *jsonFlag)
+	}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("error starting mpv: %s", err)
+	if *shareFlag {
+		return printShare(ctx, somafm.NewPlayer(*socketPath, false), config, *jsonFlag)
 	}
 
-	c.signals = make(chan os.Signal, 1)
-	signal.Notify(c.signals, syscall.SIGINT, syscall.SIGTERM)
+	if *menubar {
+		return printMenubarStatus(ctx, somafm.NewPlayer(*socketPath, false), config, *socketPath)
+	}
 
-	var sig os.Signal
+	if *barFlag {
+		return runBar(ctx, somafm.NewPlayer(*socketPath, false), config)
+	}
 
-	go func() {
-		sig = <-c.signals
-		if err := cmd.Process.Kill(); err != nil {
-			fmt.Printf("Error killing process: %s\n", err)
+	player := somafm.NewPlayer(*socketPath, *startMpv)
+	player.StartTimeout = *mpvStartTimeout
+	if *mpvLog != "" {
+		f, err := os.OpenFile(*mpvLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to open mpv log file: %w", err)
 		}
-	}()
+		defer f.Close()
+		player.OutputLog = f
+	}
 
-	go func() {
-		err := cmd.Wait()
-		if sig == nil || sig.String() != "somaStopSignal" {
-			fmt.Printf("mpv exited: %s\n", err)
+	if *play != "" || *playRandomFlag {
+		quality, overrides, err := streamQuality(config, *qualityFlag)
+		if err != nil {
+			return err
 		}
-		os.Exit(1)
-	}()
-
-	return nil
-}
-
-func (m *mpvConfig) startMpvClient() error {
-	ipcc, err := mpv.NewIPCClient(m.socketPath)
-	if err != nil {
-		if m.startMpv {
-			err = runMpv(m)
-			for i := 0; i < 15; i++ {
-				ipcc, err = mpv.NewIPCClient(m.socketPath)
-				if err == nil {
-					break
-				}
-				time.Sleep(1 * time.Second)
-			}
-			if err != nil {
-				return fmt.Errorf("error connecting to mpv: %s", err)
-			}
-		} else {
-			return fmt.Errorf("error connecting to mpv: %s", err)
+		player.SetQualityOverrides(overrides)
+		if *play != "" {
+			return playChannel(ctx, player, config, *play, quality)
 		}
+		return playRandom(ctx, player, config, *genre, *category, *favoritesOnly, quality)
 	}
-	m.ipccClient = ipcc
-	m.mpv = mpv.NewClient(m.ipccClient)
-	return nil
-}
 
-func (m *model) RegisterMpvEventHandler(p *tea.Program) {
-	m.mpvConfig.mpv.ObserveProperty("media-title")
-	m.mpvConfig.mpv.ObserveProperty("core-idle")
-	m.mpvConfig.mpv.RegisterHandler(func(r *mpv.Response) {
-		if r.Event == "property-change" && r.Name == "media-title" {
-			if r.Data == nil {
-				return
-			}
-			p.Send(currentTitleUpdateMsg{title: r.Data.(string)})
-		} else if r.Event == "property-change" && r.Name == "core-idle" {
-			if r.Data == nil {
-				return
+	if !isatty.IsTerminal(os.Stdout.Fd()) || !isatty.IsTerminal(os.Stdin.Fd()) {
+		return errNoTerminal
+	}
+
+	// The interface draws over stderr.
+	var logPath string
+	if *logJSON == "" && *logFile == "" {
+		path, err := interfaceLogPath()
+		if err == nil {
+			var f *os.File
+			if f, err = setupLogging(config.LogLevel, verbose, path); f != nil {
+				defer f.Close()
+				logPath = path
 			}
-			p.Send(changePausedStatusMsg{paused: r.Data.(bool)})
 		}
-	})
-}
-
-/* CONFIG */
-
-type somaConfig struct {
-	CurrentlyPlaying       string    `json:"currentlyPlaying"`
-	IsPaused               bool      `json:"isPaused"`
-	Channels               channels  `json:"channels"`
-	LastChannelsListUpdate time.Time `json:"lastChannelsListUpdate"`
-}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: logging to stderr:", err)
+		}
+	}
 
-func (c *somaConfig) saveConfig() error {
-	if c == nil {
-		return nil
+	theme := config.Theme
+	if *themeFlag != "" {
+		theme = *themeFlag
 	}
-	configDir, err := os.UserConfigDir()
-	if err != nil {
+	if err := applyTheme(theme); err != nil {
 		return err
 	}
-
-	configPath := filepath.Join(configDir, "soma.json")
-
-	file, err := os.OpenFile(configPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return err
+	lite := *liteFlag || config.Lite
+	if lite {
+		applyLite()
+	}
+	if err := applyGlyphs(config.Glyphs); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning:", err)
 	}
-	defer file.Close()
+	// The margin and padding were checked when loading the config.
+	docStyle, _ = newDocStyle(config.Margin, config.Padding)
 
-	data, err := json.MarshalIndent(c, "", "  ")
-	if err != nil {
-		return err
+	options := []tea.ProgramOption{tea.WithContext(ctx)}
+	if *mouse {
+		options = append(options, tea.WithMouseCellMotion())
+	}
+	if !*inline {
+		options = append(options, tea.WithAltScreen())
+	}
+	if lite {
+		options = append(options, tea.WithFPS(liteFPS))
 	}
 
-	_, err = file.Write(data)
-	if err != nil {
-		return err
+	if *noMpv {
+		return runDashboard(ctx, config, options...)
 	}
 
-	return nil
-}
+	if firstRun && !*noSetup {
+		if err := runSetup(ctx, config, options...); errors.Is(err, errSetupAborted) {
+			return nil
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: setup failed:", err)
+		}
+	}
 
-func loadConfig() (*somaConfig, error) {
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		return &somaConfig{}, err
+	mpvExited := make(chan error, 1)
+	player.OnMpvExit = func(err error) {
+		select {
+		case mpvExited <- err:
+		default:
+		}
 	}
 
-	configPath := filepath.Join(configDir, "soma.json")
+	if err := player.Connect(ctx); err != nil {
+		return fmt.Errorf("unable to connect to mpv: %w", err)
+	}
+	if err := player.CheckMpvVersion(); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+	}
 
-	file, err := os.Open(configPath)
-	if err != nil {
-		return &somaConfig{}, err
+	artwork, err := newArtworkCache()
+	if err == nil {
+		artwork.Clean()
+	}
+	if path, err := historyPath(); err == nil {
+		if err := rotateJSONLines(path, config.historyRetention()); err != nil {
+			logger.Warn("rotating history", "path", path, "error", err)
+		}
 	}
-	defer file.Close()
 
-	var c somaConfig
+	if *sortFlag != "" {
+		order, err := somafm.ParseSortOrder(*sortFlag)
+		if err != nil {
+			return err
+		}
+		config.SortMode = order
+	}
 
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&c)
+	tui, err := initialModel(ctx, player, config)
 	if err != nil {
-		return &somaConfig{}, err
+		return err
 	}
+	if *detach {
+		tui.keepPlaying = true
+	}
+	tui.untilEnd = *untilEnd
+	tui.lite = lite
+	if *preset != "" {
+		if err := tui.applyPreset(*preset); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		}
+	}
+	if *rotateFavorites || config.RotateFavorites {
+		if err := tui.rotateFavorites(); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		}
+	}
+	tui.list.Styles.Title = titleStyle
 
-	return &c, nil
-}
-
-/* MAIN */
+	tui.list.Paginator.ActiveDot = paginationActiveStyle.Render("•")
+	tui.list.Paginator.InactiveDot = paginationInactiveStyle.Render("•")
 
-func main() {
-	flags := flag.NewFlagSet("soma", flag.ExitOnError)
-	socketPath := flags.String("socket", "/tmp/mpvsocket.sock", "Path to mpv socket")
-	startMpv := flags.Bool("start-mpv", true, "Start mpv if not running")
-	flags.Parse(os.Args[1:])
+	tui.mpris = newMPRIS()
+	tui.artwork = artwork
+	tui.web = newWebServer(*webAddr)
+	p := newProgram(tui, options...)
+	go func() {
+		// mpv going away ends the interface, see mpvExitedMsg.
+		select {
+		case err := <-mpvExited:
+			p.Send(mpvExitedMsg{err: err})
+		case <-ctx.Done():
+		}
+	}()
 
-	mpvClient := mpvConfig{
-		socketPath: *socketPath,
-		startMpv:   *startMpv,
+	tui.RegisterMpvEventHandler(p)
+	handleControlSignals(ctx, p)
+	tui.mpris.serve(ctx, p)
+	if err := tui.web.serve(ctx, p); err != nil {
+		return fmt.Errorf("unable to start the web interface: %w", err)
 	}
 
-	err := mpvClient.startMpvClient()
+	final, err := runProgram(p)
 	if err != nil {
-		fmt.Println("Unable to connect to mpv", err)
-		os.Exit(1)
+		return err
 	}
-
-	model := initialModel(&mpvClient)
-	model.list.SetShowPagination(true)
-	model.list.SetShowStatusBar(false)
-	model.list.Styles.Title = titleStyle
-
-	model.list.Paginator.ActiveDot = paginationActiveStyle.Render("•")
-	model.list.Paginator.InactiveDot = paginationInactiveStyle.Render("•")
-
-	p := tea.NewProgram(model)
-
-	model.RegisterMpvEventHandler(p)
-
-	if _, err := p.Run(); err != nil {
-		fmt.Print(err)
-		os.Exit(1)
+	if logPath != "" {
+		fmt.Fprintf(os.Stderr, "Logs written to %s\n", logPath)
+	}
+	m, ok := final.(model)
+	if !ok {
+		return nil
+	}
+	if m.mpvExited {
+		err := fmt.Errorf("%w: %w", errMpvExited, m.mpvExitErr)
+		if out := player.MpvOutput(); out != "" {
+			err = fmt.Errorf("%w\n%s", err, out)
+		}
+		return err
 	}
+	if m.saveErr != nil {
+		logger.Error("saving config", "error", m.saveErr)
+		return fmt.Errorf("unable to save config, playback state and preferences were not saved: %w", m.saveErr)
+	}
+	return nil
 }
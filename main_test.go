@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Everything started alongside the interface stops once the root context is
+// cancelled, as it is on quit.
+func TestShutdownLeavesNoGoroutines(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(t *testing.T, ctx context.Context, p *tea.Program)
+	}{
+		{"control signals", func(t *testing.T, ctx context.Context, p *tea.Program) {
+			handleControlSignals(ctx, p)
+		}},
+		{"mpris", func(t *testing.T, ctx context.Context, p *tea.Program) {
+			privateSessionBus(t)
+			newMPRIS().serve(ctx, p)
+		}},
+		{"web", func(t *testing.T, ctx context.Context, p *tea.Program) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ln.Close()
+			s := newWebServer(ln.Addr().String())
+			if err := s.serve(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+			// Leave a connection open for the shutdown to close.
+			res, err := http.Get("http://" + s.addr + "/api/status")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			http.DefaultClient.CloseIdleConnections()
+		}},
+	}
+	// os/signal starts a goroutine of its own the first time it is used,
+	// which stays for good.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	signal.Stop(signals)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			ctx, cancel := context.WithCancel(context.Background())
+			p := tea.NewProgram(nopModel{}, tea.WithContext(ctx))
+			tt.start(t, ctx, p)
+			cancel()
+
+			deadline := time.Now().Add(time.Second)
+			for runtime.NumGoroutine() > before {
+				if time.Now().After(deadline) {
+					var stacks strings.Builder
+					pprof.Lookup("goroutine").WriteTo(&stacks, 1)
+					t.Fatalf("%d goroutines left over, %d before:\n%s", runtime.NumGoroutine(), before, stacks.String())
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// privateSessionBus skips tests that register on the session bus unless
+// SOMA_TEST_DBUS says it is one of their own, as with
+// SOMA_TEST_DBUS=1 dbus-run-session go test ./...
+func privateSessionBus(t *testing.T) {
+	t.Helper()
+	if os.Getenv("SOMA_TEST_DBUS") == "" || os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		t.Skip("no private session bus, set SOMA_TEST_DBUS under dbus-run-session")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// configVersion is the version of the soma.json format this soma writes.
+// Bump it along with a new migration whenever existing settings move.
+const configVersion = 1
+
+// migrations[i] upgrades a config from version i to i+1. They work on the
+// raw JSON so that they can read settings the current struct no longer has.
+var migrations = []func(map[string]json.RawMessage) error{
+	migrateBaselineChannels,
+}
+
+// migrateConfig upgrades a config read from disk to configVersion. Configs
+// from before versioning are version 0.
+func migrateConfig(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		// Leave reporting the error to the decoder.
+		return data, nil
+	}
+	version := 0
+	if raw, ok := fields["configVersion"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, fmt.Errorf("configVersion: %w", err)
+		}
+	}
+	if version > configVersion {
+		return nil, fmt.Errorf("written by a newer soma (config version %d, this one reads up to %d)", version, configVersion)
+	}
+	if version == configVersion {
+		return data, nil
+	}
+	for v := version; v < configVersion; v++ {
+		if err := migrations[v](fields); err != nil {
+			return nil, fmt.Errorf("upgrading from config version %d: %w", v, err)
+		}
+	}
+	fields["configVersion"], _ = json.Marshal(configVersion)
+	return json.Marshal(fields)
+}
+
+// migrateBaselineChannels drops the IsPlaying field the first soma wrote
+// into each cached channel, and expires the cache, which lacks the listener
+// counts and images soma reads now. It is kept until fetched again.
+func migrateBaselineChannels(fields map[string]json.RawMessage) error {
+	raw, ok := fields["channels"]
+	if !ok {
+		return nil
+	}
+	var cache struct {
+		Channels []map[string]json.RawMessage `json:"channels"`
+	}
+	if json.Unmarshal(raw, &cache) != nil {
+		// Leave reporting the error to the decoder.
+		return nil
+	}
+	for _, c := range cache.Channels {
+		delete(c, "IsPlaying")
+	}
+	fields["channels"], _ = json.Marshal(cache)
+	delete(fields, "lastChannelsListUpdate")
+	return nil
+}
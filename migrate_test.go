@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// baselineConfig is a soma.json as the first soma wrote it, before config
+// versions: its channel cache carries the IsPlaying pointer of the list
+// items.
+const baselineConfig = `{
+  "currentlyPlaying": "dronezone",
+  "isPaused": true,
+  "channels": {
+    "channels": [
+      {
+        "title": "Groove Salad",
+        "highestpls": "https://api.somafm.com/groovesalad130.pls",
+        "fastpls": [
+          "https://api.somafm.com/groovesalad.pls",
+          "https://api.somafm.com/groovesalad2.pls"
+        ],
+        "slowpls": "https://api.somafm.com/groovesalad64.pls",
+        "id": "groovesalad",
+        "description": "A nicely chilled plate of ambient/downtempo beats and grooves.",
+        "genre": "ambient|electronica",
+        "IsPlaying": false
+      },
+      {
+        "title": "Drone Zone",
+        "highestpls": "https://api.somafm.com/dronezone130.pls",
+        "fastpls": [
+          "https://api.somafm.com/dronezone.pls"
+        ],
+        "slowpls": "https://api.somafm.com/dronezone64.pls",
+        "id": "dronezone",
+        "description": "Served best chilled, safe with most medications.",
+        "genre": "ambient|space",
+        "IsPlaying": true
+      }
+    ]
+  },
+  "lastChannelsListUpdate": "2024-01-02T03:04:05.123456789+01:00"
+}`
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+		err  string
+	}{
+		{
+			name: "baseline",
+			in:   `{"currentlyPlaying": "lush", "isPaused": false, "channels": {"channels": [{"id": "lush", "title": "Lush", "IsPlaying": null}]}, "lastChannelsListUpdate": "2024-01-02T03:04:05Z"}`,
+			want: map[string]any{
+				"configVersion":    1.0,
+				"currentlyPlaying": "lush",
+				"isPaused":         false,
+				"channels":         map[string]any{"channels": []any{map[string]any{"id": "lush", "title": "Lush"}}},
+			},
+		},
+		{
+			name: "baseline without channels",
+			in:   `{"isPaused": true}`,
+			want: map[string]any{"configVersion": 1.0, "isPaused": true},
+		},
+		{
+			name: "current",
+			in:   `{"configVersion": 1, "sortMode": ["genre", "title"], "lastChannelsListUpdate": "2024-01-02T03:04:05Z"}`,
+			want: map[string]any{"configVersion": 1.0, "sortMode": []any{"genre", "title"}, "lastChannelsListUpdate": "2024-01-02T03:04:05Z"},
+		},
+		{
+			name: "newer",
+			in:   `{"configVersion": 99}`,
+			err:  "written by a newer soma",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := migrateConfig([]byte(tt.in))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if gj, wj := mustJSON(t, got), mustJSON(t, tt.want); gj != wj {
+				t.Errorf("got %s, want %s", gj, wj)
+			}
+		})
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// A config written by the first soma loads with its settings and cached
+// channels, due for a refresh, and is saved at the current version.
+func TestLoadBaselineConfig(t *testing.T) {
+	configFile = filepath.Join(t.TempDir(), "soma.json")
+	t.Cleanup(func() { configFile = "" })
+	if err := os.WriteFile(configFile, []byte(baselineConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CurrentlyPlaying != "dronezone" || !c.IsPaused {
+		t.Errorf("settings lost: %+v", c)
+	}
+	if len(c.Channels.Channels) != 2 {
+		t.Fatalf("%d channels, want 2", len(c.Channels.Channels))
+	}
+	gs := c.Channels.Channels[0]
+	if gs.Id != "groovesalad" || gs.ChannelTitle != "Groove Salad" || len(gs.FastURL) != 2 || gs.SlowURL == "" || gs.Genre != "ambient|electronica" {
+		t.Errorf("channel lost: %+v", gs)
+	}
+	if !c.channelsStale() {
+		t.Error("baseline channel cache not due for a refresh")
+	}
+
+	if err := c.saveConfig(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "IsPlaying") {
+		t.Error("IsPlaying saved again")
+	}
+	var saved struct {
+		ConfigVersion int `json:"configVersion"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.ConfigVersion != configVersion {
+		t.Errorf("saved version %d, want %d", saved.ConfigVersion, configVersion)
+	}
+	again, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.CurrentlyPlaying != "dronezone" || len(again.Channels.Channels) != 2 {
+		t.Errorf("settings lost on reload: %+v", again)
+	}
+}
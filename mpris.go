@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/url"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// mprisState is the playback soma reports to MPRIS clients such as
+// playerctl.
+type mprisState struct {
+	status  string // Playing, Paused or Stopped
+	channel *somafm.Channel
+	title   string
+	volume  float64
+	artwork string // file URL of the cached channel image, once downloaded
+}
+
+// Actions MPRIS clients can ask for.
+const (
+	mprisPlay      = "Play"
+	mprisPause     = "Pause"
+	mprisPlayPause = "PlayPause"
+	mprisStop      = "Stop"
+	mprisNext      = "Next"
+	mprisPrevious  = "Previous"
+	mprisQuit      = "Quit"
+	mprisVolume    = "Volume"
+)
+
+type mprisMsg struct {
+	action string
+	volume float64
+}
+
+func (s mprisState) channelID() string {
+	if s.channel == nil {
+		return ""
+	}
+	return s.channel.Id
+}
+
+func (m *model) mprisState() mprisState {
+	s := mprisState{status: "Stopped", title: m.title, volume: m.volume}
+	if m.attached {
+		return s
+	}
+	c, ok := m.playingChannel()
+	if !ok {
+		return s
+	}
+	s.channel = c
+	if m.artworkPath != "" && m.artworkURL == c.ArtworkURL() {
+		s.artwork = (&url.URL{Scheme: "file", Path: filepath.ToSlash(m.artworkPath)}).String()
+	}
+	switch {
+	case m.playing != "":
+		s.status = "Playing"
+	case m.player.Playing() != "":
+		s.status = "Paused"
+	}
+	return s
+}
+
+// handleMPRIS does what an MPRIS client asked for, like the matching key.
+func (m *model) handleMPRIS(msg mprisMsg) tea.Cmd {
+	switch msg.action {
+	case mprisPlay:
+		if m.playing == "" {
+			m.resume()
+		}
+	case mprisPause, mprisStop:
+		if m.playing != "" {
+			m.pause()
+		}
+	case mprisPlayPause:
+		m.togglePause()
+	case mprisNext:
+		return m.surf(1)
+	case mprisPrevious:
+		return m.surf(-1)
+	case mprisQuit:
+		return m.quit()
+	case mprisVolume:
+		m.player.Client().SetProperty("volume", min(max(msg.volume*100, 0), 100))
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	mprisPath        = "/org/mpris/MediaPlayer2"
+	mprisBusName     = "org.mpris.MediaPlayer2.soma"
+	mprisRootIface   = "org.mpris.MediaPlayer2"
+	mprisPlayerIface = "org.mpris.MediaPlayer2.Player"
+	mprisNoTrack     = dbus.ObjectPath("/org/mpris/MediaPlayer2/TrackList/NoTrack")
+)
+
+// mprisServer exposes soma on the session bus as an MPRIS media player, for
+// playerctl and desktop media keys. update does nothing until serve
+// connected, or at all without a session bus.
+type mprisServer struct {
+	props *prop.Properties
+	last  mprisState
+}
+
+// registered reports whether soma is on the session bus.
+func (s *mprisServer) registered() bool {
+	return s != nil && s.props != nil
+}
+
+func newMPRIS() *mprisServer {
+	return &mprisServer{}
+}
+
+// mprisRoot and mprisPlayer forward the MPRIS method calls to the interface.
+type mprisRoot struct {
+	p *tea.Program
+}
+
+func (r mprisRoot) Raise() *dbus.Error {
+	return nil
+}
+
+func (r mprisRoot) Quit() *dbus.Error {
+	r.p.Send(mprisMsg{action: mprisQuit})
+	return nil
+}
+
+type mprisPlayer struct {
+	p *tea.Program
+}
+
+func (pl mprisPlayer) send(action string) *dbus.Error {
+	pl.p.Send(mprisMsg{action: action})
+	return nil
+}
+
+func (pl mprisPlayer) Play() *dbus.Error      { return pl.send(mprisPlay) }
+func (pl mprisPlayer) Pause() *dbus.Error     { return pl.send(mprisPause) }
+func (pl mprisPlayer) PlayPause() *dbus.Error { return pl.send(mprisPlayPause) }
+func (pl mprisPlayer) Stop() *dbus.Error      { return pl.send(mprisStop) }
+func (pl mprisPlayer) Next() *dbus.Error      { return pl.send(mprisNext) }
+func (pl mprisPlayer) Previous() *dbus.Error  { return pl.send(mprisPrevious) }
+
+// Streams can't seek. SeekBy is exported as Seek, a name go vet keeps for
+// io.Seeker.
+func (pl mprisPlayer) SeekBy(offset int64) *dbus.Error { return nil }
+
+func (pl mprisPlayer) SetPosition(track dbus.ObjectPath, position int64) *dbus.Error {
+	return nil
+}
+
+func (pl mprisPlayer) OpenUri(uri string) *dbus.Error {
+	return dbus.MakeFailedError(errors.New("soma only plays SomaFM channels"))
+}
+
+// serve connects to the session bus and registers soma there, under
+// org.mpris.MediaPlayer2.soma or, if another soma has it, a name of its
+// own.
+func (s *mprisServer) serve(ctx context.Context, p *tea.Program) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		logger.Debug("no session bus, MPRIS disabled", "error", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	root, player := mprisRoot{p}, mprisPlayer{p}
+	props, err := prop.Export(conn, mprisPath, mprisProps(p))
+	if err == nil {
+		err = conn.Export(root, mprisPath, mprisRootIface)
+	}
+	if err == nil {
+		err = conn.ExportWithMap(player, map[string]string{"SeekBy": "Seek"}, mprisPath, mprisPlayerIface)
+	}
+	playerMethods := introspect.Methods(player)
+	for i := range playerMethods {
+		if playerMethods[i].Name == "SeekBy" {
+			playerMethods[i].Name = "Seek"
+		}
+	}
+	if err == nil {
+		err = conn.Export(introspect.NewIntrospectable(&introspect.Node{
+			Name: mprisPath,
+			Interfaces: []introspect.Interface{
+				introspect.IntrospectData,
+				prop.IntrospectData,
+				{Name: mprisRootIface, Methods: introspect.Methods(root), Properties: props.Introspection(mprisRootIface)},
+				{Name: mprisPlayerIface, Methods: playerMethods, Properties: props.Introspection(mprisPlayerIface)},
+			},
+		}), mprisPath, "org.freedesktop.DBus.Introspectable")
+	}
+	if err != nil {
+		logger.Warn("exporting MPRIS interface", "error", err)
+		return
+	}
+
+	name := mprisBusName
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err == nil && reply != dbus.RequestNameReplyPrimaryOwner {
+		name = fmt.Sprintf("%s.instance%d", mprisBusName, os.Getpid())
+		reply, err = conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	}
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		logger.Warn("registering on the session bus", "name", name, "error", err)
+		return
+	}
+	logger.Info("serving MPRIS", "name", name)
+	s.props = props
+}
+
+// mprisProps returns the properties of the MPRIS root and player
+// interfaces, as they are before update first runs.
+func mprisProps(p *tea.Program) prop.Map {
+	readOnly := func(v any) *prop.Prop {
+		return &prop.Prop{Value: v, Emit: prop.EmitTrue}
+	}
+	return prop.Map{
+		mprisRootIface: {
+			"CanQuit":             readOnly(true),
+			"CanRaise":            readOnly(false),
+			"HasTrackList":        readOnly(false),
+			"Identity":            readOnly("soma"),
+			"SupportedUriSchemes": readOnly([]string{}),
+			"SupportedMimeTypes":  readOnly([]string{}),
+		},
+		mprisPlayerIface: {
+			"PlaybackStatus": readOnly("Stopped"),
+			"Rate":           readOnly(1.0),
+			"MinimumRate":    readOnly(1.0),
+			"MaximumRate":    readOnly(1.0),
+			"Metadata":       readOnly(map[string]dbus.Variant{"mpris:trackid": dbus.MakeVariant(mprisNoTrack)}),
+			"Volume": {Value: 1.0, Writable: true, Emit: prop.EmitTrue, Callback: func(c *prop.Change) *dbus.Error {
+				v, ok := c.Value.(float64)
+				if !ok {
+					return prop.ErrInvalidArg
+				}
+				// prop holds its lock while calling back, and update needs
+				// it: the interface must not be waited for.
+				go p.Send(mprisMsg{action: mprisVolume, volume: v})
+				return nil
+			}},
+			"Position":      {Value: int64(0), Emit: prop.EmitFalse},
+			"CanGoNext":     readOnly(true),
+			"CanGoPrevious": readOnly(true),
+			"CanPlay":       readOnly(true),
+			"CanPause":      readOnly(true),
+			"CanSeek":       readOnly(false),
+			"CanControl":    readOnly(true),
+		},
+	}
+}
+
+// update tells MPRIS clients about state, if it changed.
+func (s *mprisServer) update(state mprisState) {
+	if s == nil || s.props == nil {
+		return
+	}
+	if state.status != s.last.status {
+		s.props.SetMust(mprisPlayerIface, "PlaybackStatus", state.status)
+	}
+	if state.title != s.last.title || state.channelID() != s.last.channelID() || state.artwork != s.last.artwork {
+		s.props.SetMust(mprisPlayerIface, "Metadata", mprisMetadata(state))
+	}
+	if state.volume != s.last.volume {
+		s.props.SetMust(mprisPlayerIface, "Volume", state.volume/100)
+	}
+	s.last = state
+}
+
+// mprisMetadata describes the channel playing as a track, with the song
+// split into artist and title the way SomaFM writes them.
+func mprisMetadata(state mprisState) map[string]dbus.Variant {
+	c := state.channel
+	if c == nil {
+		return map[string]dbus.Variant{"mpris:trackid": dbus.MakeVariant(mprisNoTrack)}
+	}
+	metadata := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/org/nbr23/soma/channel/" + objectPathElement(c.Id))),
+		"xesam:album":   dbus.MakeVariant(c.ChannelTitle),
+		"xesam:title":   dbus.MakeVariant(c.ChannelTitle),
+		"xesam:url":     dbus.MakeVariant(c.PageURL()),
+	}
+	if artist, title, ok := strings.Cut(state.title, " - "); ok {
+		metadata["xesam:artist"] = dbus.MakeVariant([]string{artist})
+		metadata["xesam:title"] = dbus.MakeVariant(title)
+	} else if state.title != "" {
+		metadata["xesam:title"] = dbus.MakeVariant(state.title)
+	}
+	// A local copy spares clients fetching the image each time it changes.
+	if state.artwork != "" {
+		metadata["mpris:artUrl"] = dbus.MakeVariant(state.artwork)
+	} else if art := c.ArtworkURL(); art != "" {
+		metadata["mpris:artUrl"] = dbus.MakeVariant(art)
+	}
+	return metadata
+}
+
+// objectPathElement replaces what D-Bus doesn't allow in an object path.
+func objectPathElement(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
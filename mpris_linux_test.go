@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// The properties of the MPRIS specification, with their D-Bus types.
+var mprisSpecProps = []struct {
+	iface, name, signature string
+	writable               bool
+}{
+	{mprisRootIface, "CanQuit", "b", false},
+	{mprisRootIface, "CanRaise", "b", false},
+	{mprisRootIface, "HasTrackList", "b", false},
+	{mprisRootIface, "Identity", "s", false},
+	{mprisRootIface, "SupportedUriSchemes", "as", false},
+	{mprisRootIface, "SupportedMimeTypes", "as", false},
+	{mprisPlayerIface, "PlaybackStatus", "s", false},
+	{mprisPlayerIface, "Rate", "d", false},
+	{mprisPlayerIface, "Metadata", "a{sv}", false},
+	{mprisPlayerIface, "Volume", "d", true},
+	{mprisPlayerIface, "Position", "x", false},
+	{mprisPlayerIface, "MinimumRate", "d", false},
+	{mprisPlayerIface, "MaximumRate", "d", false},
+	{mprisPlayerIface, "CanGoNext", "b", false},
+	{mprisPlayerIface, "CanGoPrevious", "b", false},
+	{mprisPlayerIface, "CanPlay", "b", false},
+	{mprisPlayerIface, "CanPause", "b", false},
+	{mprisPlayerIface, "CanSeek", "b", false},
+	{mprisPlayerIface, "CanControl", "b", false},
+}
+
+func TestMPRISProps(t *testing.T) {
+	props := mprisProps(nil)
+	for _, want := range mprisSpecProps {
+		t.Run(want.iface+"."+want.name, func(t *testing.T) {
+			p, ok := props[want.iface][want.name]
+			if !ok {
+				t.Fatal("missing")
+			}
+			if got := dbus.SignatureOf(p.Value).String(); got != want.signature {
+				t.Errorf("signature %s, want %s", got, want.signature)
+			}
+			if p.Writable != want.writable {
+				t.Errorf("writable %t, want %t", p.Writable, want.writable)
+			}
+		})
+	}
+}
+
+func TestMPRISMethods(t *testing.T) {
+	var names []string
+	for _, m := range introspect.Methods(mprisPlayer{}) {
+		names = append(names, m.Name)
+	}
+	// SeekBy is exported as Seek.
+	for _, want := range []string{"Next", "Previous", "Pause", "PlayPause", "Stop", "Play", "SeekBy", "SetPosition", "OpenUri"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("player is missing %s", want)
+		}
+	}
+	names = nil
+	for _, m := range introspect.Methods(mprisRoot{}) {
+		names = append(names, m.Name)
+	}
+	for _, want := range []string{"Raise", "Quit"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("root is missing %s", want)
+		}
+	}
+}
+
+// The Volume callback runs with prop's lock held, which update needs too:
+// it must return without waiting for the interface.
+func TestMPRISVolumeCallbackDoesNotBlock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := tea.NewProgram(nopModel{}, tea.WithContext(ctx))
+	volume := mprisProps(p)[mprisPlayerIface]["Volume"]
+
+	tests := []struct {
+		value any
+		want  *dbus.Error
+	}{
+		{0.5, nil},
+		{"loud", prop.ErrInvalidArg},
+	}
+	for _, tt := range tests {
+		done := make(chan *dbus.Error, 1)
+		go func() {
+			done <- volume.Callback(&prop.Change{Iface: mprisPlayerIface, Name: "Volume", Value: tt.value})
+		}()
+		select {
+		case err := <-done:
+			if err != tt.want {
+				t.Errorf("Volume set to %v: %v, want %v", tt.value, err, tt.want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Volume set to %v blocked", tt.value)
+		}
+	}
+}
+
+func TestMPRISMetadata(t *testing.T) {
+	c := &somafm.Channel{Id: "groove-salad", ChannelTitle: "Groove Salad", Image: "small.png", LargeImage: "large.png"}
+	tests := []struct {
+		name  string
+		state mprisState
+		want  map[string]any
+	}{
+		{
+			name:  "stopped",
+			state: mprisState{},
+			want:  map[string]any{"mpris:trackid": mprisNoTrack},
+		},
+		{
+			name:  "artist and title",
+			state: mprisState{channel: c, title: "Boards of Canada - Dayvan Cowboy"},
+			want: map[string]any{
+				"mpris:trackid": dbus.ObjectPath("/org/nbr23/soma/channel/groove_salad"),
+				"xesam:album":   "Groove Salad",
+				"xesam:artist":  []string{"Boards of Canada"},
+				"xesam:title":   "Dayvan Cowboy",
+				"xesam:url":     c.PageURL(),
+				"mpris:artUrl":  "large.png",
+			},
+		},
+		{
+			name:  "title only",
+			state: mprisState{channel: c, title: "Station ID"},
+			want: map[string]any{
+				"mpris:trackid": dbus.ObjectPath("/org/nbr23/soma/channel/groove_salad"),
+				"xesam:album":   "Groove Salad",
+				"xesam:title":   "Station ID",
+				"xesam:url":     c.PageURL(),
+				"mpris:artUrl":  "large.png",
+			},
+		},
+		{
+			name:  "cached art",
+			state: mprisState{channel: c, artwork: "file:///cache/soma/artwork/large"},
+			want: map[string]any{
+				"mpris:trackid": dbus.ObjectPath("/org/nbr23/soma/channel/groove_salad"),
+				"xesam:album":   "Groove Salad",
+				"xesam:title":   "Groove Salad",
+				"xesam:url":     c.PageURL(),
+				"mpris:artUrl":  "file:///cache/soma/artwork/large",
+			},
+		},
+		{
+			name:  "no track yet",
+			state: mprisState{channel: c},
+			want: map[string]any{
+				"mpris:trackid": dbus.ObjectPath("/org/nbr23/soma/channel/groove_salad"),
+				"xesam:album":   "Groove Salad",
+				"xesam:title":   "Groove Salad",
+				"xesam:url":     c.PageURL(),
+				"mpris:artUrl":  "large.png",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mprisMetadata(tt.state)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %d entries %v, want %d", len(got), got, len(tt.want))
+			}
+			for k, want := range tt.want {
+				if v, ok := got[k]; !ok || !equalValues(v.Value(), want) {
+					t.Errorf("%s = %v, want %v", k, v, want)
+				}
+			}
+		})
+	}
+}
+
+func equalValues(a, b any) bool {
+	as, aok := a.([]string)
+	bs, bok := b.([]string)
+	if aok && bok {
+		return slices.Equal(as, bs)
+	}
+	return a == b
+}
+
+// TestMPRISSessionBus checks what playerctl sees, on a private session bus.
+func TestMPRISSessionBus(t *testing.T) {
+	privateSessionBus(t)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Skip("no session bus:", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newMPRIS()
+	s.serve(ctx, tea.NewProgram(nopModel{}, tea.WithContext(ctx)))
+	if s.props == nil {
+		t.Fatal("not registered")
+	}
+
+	var name string
+	var names []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range names {
+		if n == mprisBusName || strings.HasPrefix(n, mprisBusName+".instance") {
+			name = n
+		}
+	}
+	if name == "" {
+		t.Fatalf("%s not on the bus", mprisBusName)
+	}
+	obj := conn.Object(name, mprisPath)
+
+	for _, want := range mprisSpecProps {
+		v, err := obj.GetProperty(want.iface + "." + want.name)
+		if err != nil {
+			t.Errorf("%s.%s: %v", want.iface, want.name, err)
+			continue
+		}
+		if got := v.Signature().String(); got != want.signature {
+			t.Errorf("%s.%s: signature %s, want %s", want.iface, want.name, got, want.signature)
+		}
+	}
+
+	c := &somafm.Channel{Id: "groovesalad", ChannelTitle: "Groove Salad"}
+	s.update(mprisState{status: "Playing", channel: c, title: "Artist - Song", volume: 50})
+	tests := []struct {
+		property string
+		want     any
+	}{
+		{"PlaybackStatus", "Playing"},
+		{"Volume", 0.5},
+	}
+	for _, tt := range tests {
+		v, err := obj.GetProperty(mprisPlayerIface + "." + tt.property)
+		if err != nil || v.Value() != tt.want {
+			t.Errorf("%s = %v (%v), want %v", tt.property, v, err, tt.want)
+		}
+	}
+
+	var xml string
+	if err := obj.Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&xml); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(xml, `<method name="Seek">`) || strings.Contains(xml, "SeekBy") {
+		t.Error("Seek is not introspected as such")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// mprisServer is only available on Linux.
+type mprisServer struct{}
+
+func newMPRIS() *mprisServer { return nil }
+
+func (s *mprisServer) serve(ctx context.Context, p *tea.Program) {}
+
+func (s *mprisServer) update(state mprisState) {}
+
+func (s *mprisServer) registered() bool { return false }
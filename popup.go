@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// switcherSize is how many channels the quick switcher offers, one per
+// digit key. It is also how many recently played channels are kept.
+const switcherSize = 9
+
+// popupStyle frames the transient views drawn over the list.
+var popupStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2)
+
+// switcherChannels returns the ids the quick switcher offers: the
+// favorites, or the recently played channels.
+func (m model) switcherChannels() []string {
+	if m.switchRecent {
+		return m.config.Recent
+	}
+	return m.config.Favorites
+}
+
+// updateSwitcher handles keys while the quick switcher is open: a digit
+// plays that channel, anything else closes it. A channel SomaFM no longer
+// lists is reported rather than played.
+func (m *model) updateSwitcher(msg tea.KeyMsg) {
+	m.switching = false
+	key := msg.String()
+	if len(key) != 1 || key[0] < '1' || key[0] > '9' {
+		return
+	}
+	ids := m.switcherChannels()
+	i := int(key[0] - '1')
+	if i >= len(ids) {
+		return
+	}
+	id := ids[i]
+	if _, ok := m.player.Channel(id); !ok {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("⚠ %s is no longer listed by SomaFM", id)))
+		return
+	}
+	if m.sampler != nil {
+		m.stopSampler()
+	}
+	m.playChannel(id)
+}
+
+func (m model) switcherView() string {
+	var b strings.Builder
+	ids := m.switcherChannels()
+	if m.switchRecent {
+		b.WriteString(titleStyle.Render("Recently played"))
+		b.WriteString("\n\n")
+		if len(ids) == 0 {
+			b.WriteString("Nothing played yet.")
+		}
+	} else {
+		b.WriteString(titleStyle.Render("Favorites"))
+		b.WriteString("\n\n")
+		if len(ids) == 0 {
+			b.WriteString("No favorites yet: press f on a channel to add it.")
+		}
+	}
+	for i, id := range ids[:min(len(ids), switcherSize)] {
+		name := id
+		if c, ok := m.config.Channels.Find(id); ok {
+			name = c.ChannelTitle
+		}
+		if id == m.playing {
+			name = fmt.Sprintf("%s %s", playingGlyph, name)
+		}
+		fmt.Fprintf(&b, "%d  %s\n", i+1, name)
+	}
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popupStyle.Render(strings.TrimRight(b.String(), "\n")))
+}
+
+// mpvLogView shows the last lines mpv printed, as many as fit.
+func (m model) mpvLogView() string {
+	out := m.player.MpvOutput()
+	if out == "" {
+		out = "mpv hasn't printed anything, or soma didn't start it."
+	}
+	lines := strings.Split(out, "\n")
+	if room := m.height - 8; room > 0 && len(lines) > room {
+		lines = lines[len(lines)-room:]
+	}
+	box := popupStyle.MaxWidth(m.width).Render(titleStyle.Render("mpv output") + "\n\n" + strings.Join(lines, "\n"))
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
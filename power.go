@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// powerPollInterval is how often the power source is checked when
+// slowOnBattery is set.
+const powerPollInterval = 30 * time.Second
+
+type powerTickMsg struct{}
+
+func powerTick() tea.Cmd {
+	return tea.Tick(powerPollInterval, func(time.Time) tea.Msg {
+		return powerTickMsg{}
+	})
+}
+
+// checkPower switches to the slow stream when the machine goes on battery,
+// whatever qualityByChannel and qualityByGenre say, and back to the
+// preferred qualities when it is plugged in again.
+func (m *model) checkPower() {
+	battery, err := onBattery()
+	if err != nil {
+		logger.Debug("checking power source", "error", err)
+		return
+	}
+	if battery == m.onBattery {
+		return
+	}
+	m.onBattery = battery
+	quality, overrides := m.config.PreferredQuality, m.config.qualityOverrides()
+	if battery {
+		quality, overrides = somafm.QualitySlow, somafm.QualityOverrides{}
+	}
+	if !m.attached {
+		var before somafm.Quality
+		c, playing := m.player.Channel(m.playing)
+		if playing {
+			before = m.player.QualityFor(*c)
+		}
+		m.player.SetQuality(quality)
+		m.player.SetQualityOverrides(overrides)
+		if playing && m.player.QualityFor(*c) != before {
+			m.startStream(m.playing)
+		}
+	}
+	if battery {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("On battery: quality %s", quality)))
+	} else {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("On AC power: quality %s", quality)))
+	}
+	m.updateTitle()
+}
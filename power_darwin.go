@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// onBattery reports whether the machine runs on battery, as told by pmset.
+func onBattery() (bool, error) {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(string(out), "'Battery Power'"), nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// onBattery reports whether the machine runs on battery, from the power
+// supplies in sysfs: it does when none of the mains adapters is online.
+// Machines without a battery are never on battery.
+func onBattery() (bool, error) {
+	supplies, err := filepath.Glob("/sys/class/power_supply/*")
+	if err != nil {
+		return false, err
+	}
+	battery, mains := false, false
+	for _, s := range supplies {
+		kind, err := os.ReadFile(filepath.Join(s, "type"))
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(string(kind)) {
+		case "Battery":
+			battery = true
+		case "Mains", "USB":
+			if online, err := os.ReadFile(filepath.Join(s, "online")); err == nil && strings.TrimSpace(string(online)) == "1" {
+				mains = true
+			}
+		}
+	}
+	return battery && !mains, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+func onBattery() (bool, error) {
+	return false, errors.New("power source detection is not supported on this system")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// quietHours caps the volume between From and To, given as "15:04". A range
+// ending before it starts runs past midnight.
+type quietHours struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Volume float64 `json:"volume"`
+}
+
+// parseClock returns the minutes since midnight of a "15:04" time.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (q quietHours) validate() error {
+	if _, err := parseClock(q.From); err != nil {
+		return err
+	}
+	if _, err := parseClock(q.To); err != nil {
+		return err
+	}
+	if q.Volume < 0 || q.Volume > 100 {
+		return fmt.Errorf("volume %v is not between 0 and 100", q.Volume)
+	}
+	return nil
+}
+
+func (q quietHours) contains(t time.Time) bool {
+	from, _ := parseClock(q.From)
+	to, _ := parseClock(q.To)
+	now := t.Hour()*60 + t.Minute()
+	if from <= to {
+		return from <= now && now < to
+	}
+	return now >= from || now < to
+}
+
+// validateQuietHours checks every entry of the schedule.
+func validateQuietHours(schedule []quietHours) error {
+	for i, q := range schedule {
+		if err := q.validate(); err != nil {
+			return fmt.Errorf("quietHours[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// activeQuietHours returns the index of the first entry of the schedule
+// covering t, or -1.
+func activeQuietHours(schedule []quietHours, t time.Time) int {
+	for i, q := range schedule {
+		if q.contains(t) {
+			return i
+		}
+	}
+	return -1
+}
+
+type quietTickMsg struct{}
+
+// quietTick fires on the next minute boundary, when quiet hours can start or
+// end.
+func quietTick() tea.Cmd {
+	return tea.Every(time.Minute, func(time.Time) tea.Msg {
+		return quietTickMsg{}
+	})
+}
+
+// applyQuietHours adjusts the volume when t crosses into or out of quiet
+// hours. Between boundaries the volume is left alone, so a manual change
+// holds until the next one.
+func (m *model) applyQuietHours(t time.Time) {
+	if m.attached {
+		return
+	}
+	i := activeQuietHours(m.config.QuietHours, t)
+	if i == m.quietIndex {
+		return
+	}
+	previous := m.quietIndex
+	m.quietIndex = i
+	client := m.player.Client()
+
+	if previous >= 0 && m.quietRestore >= 0 {
+		// Only restore the volume if nobody touched it since it was capped.
+		if v, err := client.GetFloatProperty("volume"); err == nil && v == m.quietCap {
+			client.SetProperty("volume", m.quietRestore)
+			m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Quiet hours over: volume back to %.0f%%", m.quietRestore)))
+		}
+	}
+	m.quietRestore = -1
+	if i < 0 {
+		return
+	}
+
+	q := m.config.QuietHours[i]
+	v, err := client.GetFloatProperty("volume")
+	if err != nil {
+		return
+	}
+	if v <= q.Volume {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Quiet hours until %s", q.To)))
+		return
+	}
+	client.SetProperty("volume", q.Volume)
+	m.quietRestore, m.quietCap = v, q.Volume
+	m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Quiet hours until %s: volume capped at %.0f%%", q.To, q.Volume)))
+}
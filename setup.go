@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+var errSetupAborted = errors.New("setup aborted")
+
+type setupOption struct {
+	title, desc, value string
+}
+
+func (o setupOption) FilterValue() string { return o.title }
+func (o setupOption) Title() string       { return o.title }
+func (o setupOption) Description() string { return o.desc }
+
+const (
+	setupChannel = iota
+	setupQuality
+	setupAutoPlay
+	setupSteps
+)
+
+// setupModel walks a new user through the main preferences before the
+// channel list is shown for the first time.
+type setupModel struct {
+	config  *somaConfig
+	step    int
+	list    list.Model
+	aborted bool
+}
+
+func newSetupModel(config *somaConfig) setupModel {
+	d := list.NewDefaultDelegate()
+	d.Styles.SelectedTitle = cursorStyle
+	d.Styles.SelectedDesc = cursorStyle
+	m := setupModel{config: config, list: list.New(nil, d, 0, 0)}
+	m.list.Styles.Title = titleStyle
+	m.list.KeyMap.Quit.SetEnabled(false)
+	m.showStep()
+	return m
+}
+
+func (m *setupModel) showStep() {
+	var items []list.Item
+	switch m.step {
+	case setupChannel:
+		m.list.Title = "Welcome to soma (1/3): pick a channel to start with"
+		items = append(items, setupOption{title: "No default channel", desc: "Start without playing anything"})
+		for _, c := range m.config.Channels.Channels {
+			items = append(items, setupOption{title: c.ChannelTitle, desc: fmt.Sprintf("%s | %s", c.Genre, c.ChannelDescription), value: c.Id})
+		}
+	case setupQuality:
+		m.list.Title = "Welcome to soma (2/3): stream quality"
+		items = []list.Item{
+			setupOption{title: "Highest", desc: "Best sound, most bandwidth", value: string(somafm.QualityHighest)},
+			setupOption{title: "Fast", desc: "Good sound, less bandwidth", value: string(somafm.QualityFast)},
+			setupOption{title: "Slow", desc: "For slow or metered connections", value: string(somafm.QualitySlow)},
+		}
+	case setupAutoPlay:
+		m.list.Title = "Welcome to soma (3/3): play on launch?"
+		items = []list.Item{
+			setupOption{title: "Yes", desc: "Resume the last channel when soma starts", value: "yes"},
+			setupOption{title: "No", desc: "Start paused", value: "no"},
+		}
+	}
+	m.list.ResetFilter()
+	m.list.SetItems(items)
+	m.list.Select(0)
+}
+
+func (m *setupModel) choose(value string) {
+	switch m.step {
+	case setupChannel:
+		m.config.CurrentlyPlaying = value
+		m.config.Selected = value
+	case setupQuality:
+		m.config.PreferredQuality = somafm.Quality(value)
+	case setupAutoPlay:
+		m.config.AutoPlay = value == "yes"
+	}
+}
+
+func (m setupModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m setupModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetSize(msg.Width-docStyle.GetHorizontalFrameSize(), msg.Height-docStyle.GetVerticalFrameSize())
+	case tea.KeyMsg:
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+		switch msg.String() {
+		case "ctrl+c":
+			m.aborted = true
+			return m, tea.Quit
+		case "esc":
+			if m.list.FilterState() != list.Unfiltered {
+				break
+			}
+			// Skip the rest of the setup, keeping the defaults.
+			return m, tea.Quit
+		case "enter":
+			if o, ok := m.list.SelectedItem().(setupOption); ok {
+				m.choose(o.value)
+			}
+			m.step++
+			if m.step == setupSteps {
+				return m, tea.Quit
+			}
+			m.showStep()
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m setupModel) View() string {
+	return docStyle.Render(m.list.View())
+}
+
+// runSetup runs the first-run setup, with the program options of the
+// interface that follows, and saves its choices, so that it is not offered
+// again.
+func runSetup(ctx context.Context, config *somaConfig, options ...tea.ProgramOption) error {
+	if err := config.refreshChannels(ctx); err != nil {
+		return fmt.Errorf("unable to fetch Somafm stations: %s", err)
+	}
+	final, err := runProgram(newProgram(newSetupModel(config), options...))
+	if err != nil {
+		return err
+	}
+	if m, ok := final.(setupModel); ok && m.aborted {
+		return errSetupAborted
+	}
+	return config.saveConfig()
+}
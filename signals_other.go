@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func handleControlSignals(ctx context.Context, p *tea.Program) {}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// handleControlSignals turns SIGUSR1 into a pause toggle and SIGUSR2 into a
+// resume, so that soma can be driven with kill(1) by media key daemons.
+func handleControlSignals(ctx context.Context, p *tea.Program) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		defer recoverCrash(p)
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 {
+					p.Send(togglePauseMsg{})
+				} else {
+					p.Send(resumeMsg{})
+				}
+			}
+		}
+	}()
+}
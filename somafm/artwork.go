@@ -0,0 +1,96 @@
+package somafm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ArtworkCache keeps downloaded channel images on disk, keyed by URL.
+type ArtworkCache struct {
+	Dir string
+	TTL time.Duration
+}
+
+// NewArtworkCache returns a cache storing images under dir for ttl.
+func NewArtworkCache(dir string, ttl time.Duration) *ArtworkCache {
+	return &ArtworkCache{Dir: dir, TTL: ttl}
+}
+
+func (a *ArtworkCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(a.Dir, hex.EncodeToString(sum[:]))
+}
+
+func (a *ArtworkCache) fresh(info os.FileInfo) bool {
+	return time.Since(info.ModTime()) < a.TTL
+}
+
+// Get returns the path of the cached image for url, downloading it first if
+// it isn't cached or has expired.
+func (a *ArtworkCache) Get(ctx context.Context, url string) (string, error) {
+	path := a.path(url)
+	if info, err := os.Stat(path); err == nil && a.fresh(info) {
+		return path, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s", url, res.Status)
+	}
+
+	if err := os.MkdirAll(a.Dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(a.Dir, "download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, res.Body); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// Clean removes expired images.
+func (a *ArtworkCache) Clean() error {
+	entries, err := os.ReadDir(a.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || a.fresh(info) {
+			continue
+		}
+		os.Remove(filepath.Join(a.Dir, e.Name()))
+	}
+	return nil
+}
+
+// Clear removes every cached image.
+func (a *ArtworkCache) Clear() error {
+	return os.RemoveAll(a.Dir)
+}
@@ -0,0 +1,96 @@
+package somafm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestArtworkCacheGet(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path != "/groovesalad.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("png"))
+	}))
+	defer srv.Close()
+	a := NewArtworkCache(t.TempDir(), time.Hour)
+	url := srv.URL + "/groovesalad.png"
+
+	tests := []struct {
+		name  string
+		url   string
+		age   time.Duration // of the cached copy
+		fetch bool
+		err   bool
+	}{
+		{name: "not cached", url: url, fetch: true},
+		{name: "cached", url: url},
+		{name: "expired", url: url, age: 2 * time.Hour, fetch: true},
+		{name: "missing", url: srv.URL + "/none.png", fetch: true, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.age != 0 {
+				old := time.Now().Add(-tt.age)
+				if err := os.Chtimes(a.path(tt.url), old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := hits
+			path, err := a.Get(context.Background(), tt.url)
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, want error %t", err, tt.err)
+			}
+			if fetched := hits > before; fetched != tt.fetch {
+				t.Errorf("fetched %t, want %t", fetched, tt.fetch)
+			}
+			if err != nil {
+				if _, err := os.Stat(a.path(tt.url)); !os.IsNotExist(err) {
+					t.Errorf("failed download cached: %v", err)
+				}
+				return
+			}
+			if data, err := os.ReadFile(path); err != nil || string(data) != "png" {
+				t.Errorf("cached %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestArtworkCacheClean(t *testing.T) {
+	a := NewArtworkCache(t.TempDir(), time.Hour)
+	fresh, stale := a.path("fresh"), a.path("stale")
+	for _, path := range []string{fresh, stale} {
+		if err := os.WriteFile(path, []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Clean(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh image removed: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale image kept: %v", err)
+	}
+
+	if err := a.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(a.Dir); !os.IsNotExist(err) {
+		t.Errorf("cache kept: %v", err)
+	}
+}
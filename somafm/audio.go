@@ -0,0 +1,45 @@
+package somafm
+
+import "fmt"
+
+// AudioDevice is an audio output mpv can play to.
+type AudioDevice struct {
+	Name        string
+	Description string
+}
+
+// AudioDevices lists the audio outputs mpv currently knows about. The list
+// changes as devices are plugged in and out.
+func (p *Player) AudioDevices() ([]AudioDevice, error) {
+	res, err := p.mpv.Exec("get_property", "audio-device-list")
+	if err != nil {
+		return nil, err
+	}
+	list, ok := res.Data.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected audio-device-list %v", res.Data)
+	}
+	var devices []AudioDevice
+	for _, item := range list {
+		d, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := d["name"].(string)
+		description, _ := d["description"].(string)
+		if name != "" {
+			devices = append(devices, AudioDevice{Name: name, Description: description})
+		}
+	}
+	return devices, nil
+}
+
+// AudioDevice returns the name of the audio output in use.
+func (p *Player) AudioDevice() (string, error) {
+	return p.GetString("audio-device")
+}
+
+// SetAudioDevice switches to the audio output with the given name.
+func (p *Player) SetAudioDevice(name string) error {
+	return p.mpv.SetProperty("audio-device", name)
+}
@@ -0,0 +1,106 @@
+package somafm
+
+import (
+	"slices"
+	"strings"
+)
+
+// OtherCategory holds the channels none of whose genres has a category.
+const OtherCategory = "Other"
+
+// DefaultCategories groups the genres SomaFM uses into a handful of broader
+// categories, for browsing by category rather than by dozens of genres.
+var DefaultCategories = Categories{
+	"ambient":        "Ambient",
+	"space":          "Ambient",
+	"drone":          "Ambient",
+	"chill":          "Ambient",
+	"downtempo":      "Ambient",
+	"electronic":     "Electronic",
+	"electronica":    "Electronic",
+	"dance":          "Electronic",
+	"house":          "Electronic",
+	"trance":         "Electronic",
+	"techno":         "Electronic",
+	"dubstep":        "Electronic",
+	"idm":            "Electronic",
+	"breaks":         "Electronic",
+	"trip-hop":       "Electronic",
+	"lounge":         "Lounge & jazz",
+	"jazz":           "Lounge & jazz",
+	"exotica":        "Lounge & jazz",
+	"bossa nova":     "Lounge & jazz",
+	"easy listening": "Lounge & jazz",
+	"soul":           "Lounge & jazz",
+	"funk":           "Lounge & jazz",
+	"rock":           "Rock & pop",
+	"alternative":    "Rock & pop",
+	"indie":          "Rock & pop",
+	"metal":          "Rock & pop",
+	"punk":           "Rock & pop",
+	"pop":            "Rock & pop",
+	"70s":            "Rock & pop",
+	"80s":            "Rock & pop",
+	"90s":            "Rock & pop",
+	"new wave":       "Rock & pop",
+	"folk":           "Folk & world",
+	"americana":      "Folk & world",
+	"country":        "Folk & world",
+	"celtic":         "Folk & world",
+	"world":          "Folk & world",
+	"bollywood":      "Folk & world",
+	"reggae":         "Folk & world",
+	"holiday":        "Holiday",
+	"christmas":      "Holiday",
+	"spoken":         "Eclectic",
+	"news":           "Eclectic",
+	"eclectic":       "Eclectic",
+	"specials":       "Eclectic",
+}
+
+// Categories maps genres, whatever their case, to categories.
+type Categories map[string]string
+
+// With returns the categories with overrides applied on top.
+func (cs Categories) With(overrides map[string]string) Categories {
+	merged := make(Categories, len(cs)+len(overrides))
+	for g, c := range cs {
+		merged[strings.ToLower(g)] = c
+	}
+	for g, c := range overrides {
+		merged[strings.ToLower(strings.TrimSpace(g))] = c
+	}
+	return merged
+}
+
+// Of returns the category of the first of the channel's genres that has
+// one, or OtherCategory.
+func (cs Categories) Of(c Channel) string {
+	for _, genre := range strings.Split(c.Genre, "|") {
+		genre = strings.ToLower(strings.TrimSpace(genre))
+		if category, ok := cs[genre]; ok {
+			return category
+		}
+	}
+	return OtherCategory
+}
+
+// List returns the categories of the channels in alphabetical order, with
+// OtherCategory last.
+func (cs Categories) List(channels []Channel) []string {
+	var list []string
+	other := false
+	for _, c := range channels {
+		category := cs.Of(c)
+		if category == OtherCategory {
+			other = true
+		} else if !slices.Contains(list, category) {
+			list = append(list, category)
+		}
+	}
+	slices.Sort(list)
+	if other {
+		list = append(list, OtherCategory)
+	}
+	return list
+}
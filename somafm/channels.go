@@ -0,0 +1,132 @@
+package somafm
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// channelsURL is where FetchChannels gets the channel list, a variable for
+// tests.
+var channelsURL = "https://somafm.com/channels.xml"
+
+// Channel is a SomaFM station, as listed in channels.xml.
+type Channel struct {
+	ChannelTitle       string   `xml:"title" json:"title"`
+	HighestURL         string   `xml:"highestpls" json:"highestpls"`
+	FastURL            []string `xml:"fastpls" json:"fastpls"`
+	SlowURL            string   `xml:"slowpls" json:"slowpls"`
+	Id                 string   `xml:"id,attr" json:"id"`
+	ChannelDescription string   `xml:"description" json:"description"`
+	Genre              string   `xml:"genre" json:"genre"`
+	DJ                 string   `xml:"dj" json:"dj"`
+	Image              string   `xml:"image" json:"image"`
+	LargeImage         string   `xml:"largeimage" json:"largeimage"`
+	XLImage            string   `xml:"xlimage" json:"xlimage"`
+	Listeners          int      `xml:"listeners" json:"listeners"`
+}
+
+type Channels struct {
+	Channels []Channel `xml:"channel" json:"channels"`
+}
+
+// Find returns the channel with the given id.
+func (c Channels) Find(id string) (*Channel, bool) {
+	for i := range c.Channels {
+		if c.Channels[i].Id == id {
+			return &c.Channels[i], true
+		}
+	}
+	return nil, false
+}
+
+// PageURL returns the channel's page on somafm.com.
+func (c Channel) PageURL() string {
+	return fmt.Sprintf("https://somafm.com/%s/", url.PathEscape(strings.ToLower(c.Id)))
+}
+
+// ArtworkURL returns the URL of the channel's largest image, or "" if it
+// has none.
+func (c Channel) ArtworkURL() string {
+	for _, u := range []string{c.XLImage, c.LargeImage, c.Image} {
+		if u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+func (c Channel) hasURL(u string) bool {
+	return c.HighestURL == u || c.SlowURL == u || slices.Contains(c.FastURL, u)
+}
+
+// FetchChannels downloads the current channel list from SomaFM.
+func FetchChannels(ctx context.Context) (*Channels, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, channelsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("fetching channels", "url", channelsURL)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Error("fetching channels", "error", err)
+		return nil, withKind(ErrNetwork, err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		logger.Error("fetching channels", "status", res.StatusCode)
+		return nil, withKind(ErrNetwork, fmt.Errorf("somafm returned %d", res.StatusCode))
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, withKind(ErrNetwork, err)
+	}
+
+	var c Channels
+
+	reader := bytes.NewReader(body)
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = charset.NewReaderLabel
+	err = decoder.Decode(&c)
+	if err != nil {
+		logger.Error("parsing channels", "error", err)
+		return nil, withKind(ErrNetwork, err)
+	}
+
+	if err := c.validate(); err != nil {
+		logger.Error("parsing channels", "error", err)
+		return nil, withKind(ErrNetwork, err)
+	}
+
+	logger.Info("fetched channels", "count", len(c.Channels))
+	return &c, nil
+}
+
+// validate drops the channels missing an id, a title or a stream, and fails
+// if none are left: an empty or mangled list from SomaFM shouldn't replace
+// a good cache.
+func (c *Channels) validate() error {
+	total := len(c.Channels)
+	c.Channels = slices.DeleteFunc(c.Channels, func(ch Channel) bool {
+		if ch.Id == "" || ch.ChannelTitle == "" || len(ch.StreamURLs(QualityHighest)) == 0 {
+			logger.Warn("skipping invalid channel", "id", ch.Id, "title", ch.ChannelTitle)
+			return true
+		}
+		return false
+	})
+	if len(c.Channels) == 0 {
+		return fmt.Errorf("no usable channel in the channel list (%d listed)", total)
+	}
+	return nil
+}
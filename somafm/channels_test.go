@@ -0,0 +1,85 @@
+package somafm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchChannels(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []string
+		err    string
+	}{
+		{
+			name:   "ok",
+			status: http.StatusOK,
+			body: `<?xml version="1.0" encoding="UTF-8"?><channels>
+				<channel id="groovesalad"><title>Groove Salad</title><highestpls>https://somafm.com/groovesalad130.pls</highestpls></channel>
+				<channel id="nostream"><title>No stream</title></channel>
+				</channels>`,
+			want: []string{"groovesalad"},
+		},
+		{
+			name:   "latin-1",
+			status: http.StatusOK,
+			body:   "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><channels><channel id=\"cafe\"><title>Caf\xe9</title><highestpls>u</highestpls></channel></channels>",
+			want:   []string{"cafe"},
+		},
+		{
+			name:   "server error",
+			status: http.StatusInternalServerError,
+			body:   "<html><body>Internal Server Error</body></html>",
+			err:    "somafm returned 500",
+		},
+		{
+			name:   "unavailable",
+			status: http.StatusServiceUnavailable,
+			err:    "somafm returned 503",
+		},
+		{
+			name:   "html page",
+			status: http.StatusOK,
+			body:   "<html><body>Down for maintenance</body></html>",
+			err:    "no usable channel",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			defer func(u string) { channelsURL = u }(channelsURL)
+			channelsURL = srv.URL
+
+			c, err := FetchChannels(context.Background())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				if !errors.Is(err, ErrNetwork) {
+					t.Errorf("%v is not ErrNetwork", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, ch := range c.Channels {
+				ids = append(ids, ch.Id)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
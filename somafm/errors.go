@@ -0,0 +1,31 @@
+package somafm
+
+import "errors"
+
+// Errors returned by the package, to tell failures apart with errors.Is.
+var (
+	// ErrChannelNotFound is returned for a channel id or name that matches
+	// no channel.
+	ErrChannelNotFound = errors.New("channel not found")
+	// ErrAmbiguousChannel is returned for a channel name that matches
+	// several channels equally well.
+	ErrAmbiguousChannel = errors.New("ambiguous channel")
+	// ErrMpvUnavailable is returned when mpv can't be started or reached.
+	ErrMpvUnavailable = errors.New("mpv unavailable")
+	// ErrNetwork is returned when SomaFM can't be reached or sends
+	// something unusable.
+	ErrNetwork = errors.New("network error")
+)
+
+// kindError makes err match one of the errors above, without changing its
+// message.
+type kindError struct {
+	kind, err error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+func withKind(kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
@@ -0,0 +1,40 @@
+package somafm
+
+import (
+	"io"
+	"log/slog"
+
+	mpv "github.com/nbr23/go-mpv"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// SetLogger makes the package log fetches, mpv IPC traffic and errors to l.
+// Nothing is logged by default.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// loggingClient logs the commands sent to mpv and the events it sends back.
+type loggingClient struct {
+	mpv.LLClient
+}
+
+func (c loggingClient) Exec(command ...interface{}) (*mpv.Response, error) {
+	res, err := c.LLClient.Exec(command...)
+	if err != nil {
+		logger.Error("ipc command", "command", command, "error", err)
+	} else if res != nil && res.Err != "" && res.Err != "success" {
+		logger.Warn("ipc command", "command", command, "error", res.Err)
+	} else {
+		logger.Debug("ipc command", "command", command)
+	}
+	return res, err
+}
+
+func (c loggingClient) RegisterHandler(h func(*mpv.Response)) {
+	c.LLClient.RegisterHandler(func(r *mpv.Response) {
+		logger.Debug("mpv event", "event", r.Event, "name", r.Name, "data", r.Data)
+		h(r)
+	})
+}
@@ -0,0 +1,50 @@
+package somafm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StreamInfo is what a stream reports about itself in its ICY headers, which
+// mpv exposes in its metadata property. It can differ from the channel list,
+// e.g. when a station is relaying another stream.
+type StreamInfo struct {
+	Name    string
+	Genre   string
+	Bitrate string
+}
+
+// ParseStreamInfo picks the ICY fields out of mpv's metadata property. Keys
+// are matched case-insensitively as servers aren't consistent about them.
+func ParseStreamInfo(metadata map[string]any) StreamInfo {
+	var info StreamInfo
+	for k, v := range metadata {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(k) {
+		case "icy-name":
+			info.Name = strings.TrimSpace(s)
+		case "icy-genre":
+			info.Genre = strings.TrimSpace(s)
+		case "icy-br":
+			info.Bitrate = strings.TrimSpace(s)
+		}
+	}
+	return info
+}
+
+func (s StreamInfo) String() string {
+	var parts []string
+	if s.Name != "" {
+		parts = append(parts, s.Name)
+	}
+	if s.Genre != "" {
+		parts = append(parts, s.Genre)
+	}
+	if s.Bitrate != "" {
+		parts = append(parts, fmt.Sprintf("%s kbps", s.Bitrate))
+	}
+	return strings.Join(parts, " · ")
+}
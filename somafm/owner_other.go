@@ -0,0 +1,10 @@
+//go:build !unix
+
+package somafm
+
+import "os"
+
+// fileOwner reports no owner: files have no uid, nor unix permissions.
+func fileOwner(fi os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,470 @@
+package somafm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	mpv "github.com/nbr23/go-mpv"
+)
+
+// Player plays SomaFM channels through an mpv instance, controlled over its
+// IPC socket.
+type Player struct {
+	socketPath string
+	startMpv   bool
+	signals    chan os.Signal
+	mpv        *mpv.Client
+	ipcClient  *mpv.IPCClient
+	channels   []Channel
+	playing    string
+	url        string
+	fallback   *QualityFallback
+	quality    Quality
+	overrides  QualityOverrides
+	reconnects int
+	output     *tailBuffer
+	exited     chan struct{}
+	exitErr    error
+	connected  atomic.Bool
+
+	prefetchMu sync.Mutex
+	prefetched prefetchedStream
+
+	// OutputLog, if set, also receives everything an mpv started by the
+	// player prints.
+	OutputLog io.Writer
+
+	// StartTimeout is how long Connect waits for an mpv it started to open
+	// its socket.
+	StartTimeout time.Duration
+
+	// OnMpvExit is called when an mpv process started by the player exits
+	// on its own, or after the program received SIGINT/SIGTERM.
+	OnMpvExit func(error)
+}
+
+// NewPlayer returns a player for the mpv instance listening on socketPath.
+// If startMpv is set, Connect spawns mpv when nothing listens on the socket.
+func NewPlayer(socketPath string, startMpv bool) *Player {
+	return &Player{
+		socketPath: socketPath,
+		startMpv:   startMpv,
+		quality:    QualityHighest,
+
+		StartTimeout: 5 * time.Second,
+	}
+}
+
+// Connect tries the socket of an mpv it started after startPollMin, then
+// doubles the wait between attempts up to startPollMax: a fast mpv is
+// picked up within milliseconds, a slow one isn't polled needlessly often.
+const (
+	startPollMin = 10 * time.Millisecond
+	startPollMax = 500 * time.Millisecond
+)
+
+type stopSignal struct{}
+
+func (s stopSignal) Signal()        {}
+func (s stopSignal) String() string { return "somaStopSignal" }
+
+// CheckSocketDir makes sure dir is fit to hold an mpv socket: a directory,
+// not a symlink, that only the current user owns and can access, so that
+// nobody else can plant a socket of their own there.
+func CheckSocketDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		return fmt.Errorf("socket directory %s is a symlink", dir)
+	case !fi.IsDir():
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	}
+	if uid, ok := fileOwner(fi); ok {
+		if uid != os.Getuid() {
+			return fmt.Errorf("socket directory %s is owned by another user", dir)
+		}
+		if perm := fi.Mode().Perm(); perm != 0700 {
+			return fmt.Errorf("socket directory %s has mode %#o, it must be 0700", dir, perm)
+		}
+	}
+	return nil
+}
+
+// checkSocketPath makes sure mpv can create its socket at path, creating the
+// directory if missing, so that a mistyped --socket fails with a clear error
+// rather than a start timeout.
+func checkSocketPath(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("error creating socket directory: %s", err)
+	}
+	if err := CheckSocketDir(dir); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return fmt.Errorf("socket path %s is a directory", path)
+	}
+	f, err := os.CreateTemp(dir, ".soma-*")
+	if err != nil {
+		return fmt.Errorf("socket directory %s is not writable: %s", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+func (p *Player) runMpv(ctx context.Context) error {
+	if err := checkSocketPath(p.socketPath); err != nil {
+		return withKind(ErrMpvUnavailable, err)
+	}
+
+	cmd := exec.Command("mpv", "--idle", fmt.Sprintf("--input-ipc-server=%s", p.socketPath))
+	p.output = newTailBuffer(mpvOutputSize)
+	var out io.Writer = p.output
+	if p.OutputLog != nil {
+		out = io.MultiWriter(p.output, p.OutputLog)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	p.exited = make(chan struct{})
+
+	if err := cmd.Start(); err != nil {
+		return withKind(ErrMpvUnavailable, fmt.Errorf("error starting mpv: %s", err))
+	}
+	logger.Info("started mpv", "pid", cmd.Process.Pid, "socket", p.socketPath)
+
+	p.signals = make(chan os.Signal, 1)
+	signal.Notify(p.signals, syscall.SIGINT, syscall.SIGTERM)
+
+	var stopped atomic.Bool
+
+	go func() {
+		select {
+		case sig := <-p.signals:
+			stopped.Store(sig == stopSignal{})
+			if err := cmd.Process.Kill(); err != nil {
+				logger.Error("killing mpv", "error", err)
+			}
+		case <-ctx.Done():
+			// The program is done with mpv but wants it to keep playing.
+			signal.Stop(p.signals)
+		}
+	}()
+
+	go func() {
+		err := cmd.Wait()
+		logger.Info("mpv exited", "error", err, "output", p.output.String())
+		p.exitErr = err
+		close(p.exited)
+		// Before the socket is up, Connect reports the exit itself.
+		if stopped.Load() || ctx.Err() != nil || !p.connected.Load() {
+			return
+		}
+		if p.OnMpvExit != nil {
+			p.OnMpvExit(err)
+		}
+	}()
+
+	return nil
+}
+
+// Connect connects to mpv, starting it first if needed and allowed. The
+// context bounds the wait for a freshly started mpv, and the lifetime of the
+// goroutines watching it.
+func (p *Player) Connect(ctx context.Context) error {
+	ipcc, err := mpv.NewIPCClient(p.socketPath)
+	if err != nil {
+		if p.startMpv {
+			if err := p.runMpv(ctx); err != nil {
+				return err
+			}
+			deadline := time.After(p.StartTimeout)
+			wait := startPollMin
+			for attempt := 1; ; attempt++ {
+				ipcc, err = mpv.NewIPCClient(p.socketPath)
+				if err == nil {
+					break
+				}
+				logger.Debug("waiting for mpv", "attempt", attempt, "retry_in", wait, "error", err)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-p.exited:
+					return withKind(ErrMpvUnavailable, p.startError(fmt.Sprintf("mpv exited while starting (%s)", p.exitErr)))
+				case <-deadline:
+					return withKind(ErrMpvUnavailable, p.startError(fmt.Sprintf("mpv did not open %s within %s", p.socketPath, p.StartTimeout)))
+				case <-time.After(wait):
+				}
+				wait = min(2*wait, startPollMax)
+			}
+		} else {
+			return withKind(ErrMpvUnavailable, fmt.Errorf("error connecting to mpv: %s", err))
+		}
+	}
+	p.ipcClient = ipcc
+	p.mpv = mpv.NewClient(loggingClient{p.ipcClient})
+	p.connected.Store(true)
+	return nil
+}
+
+// mpvOutputSize bounds how much of mpv's output is kept in memory.
+const mpvOutputSize = 16 << 10
+
+// MpvOutput returns the last lines printed by an mpv started by the player,
+// oldest first.
+func (p *Player) MpvOutput() string {
+	if p.output == nil {
+		return ""
+	}
+	return p.output.String()
+}
+
+// startError describes a failed mpv start, with what mpv printed, if
+// anything.
+func (p *Player) startError(reason string) error {
+	if out := p.output.String(); out != "" {
+		return fmt.Errorf("%s, it said:\n%s", reason, out)
+	}
+	return errors.New(reason)
+}
+
+// Client returns the underlying mpv client, for features not covered by the
+// Player API.
+func (p *Player) Client() *mpv.Client {
+	return p.mpv
+}
+
+// Close stops the mpv process if the player started it, and pauses playback
+// otherwise.
+func (p *Player) Close() {
+	if p.signals != nil {
+		p.signals <- stopSignal{}
+	} else if p.mpv != nil {
+		p.mpv.SetPause(true)
+	}
+}
+
+// Started reports whether the player started the mpv it is connected to,
+// rather than attaching to one that was already running.
+func (p *Player) Started() bool {
+	return p.signals != nil
+}
+
+// Detach lets go of mpv without stopping or pausing it, so that it keeps
+// playing after the program exits.
+func (p *Player) Detach() {
+	if p.signals != nil {
+		signal.Stop(p.signals)
+	}
+}
+
+// SetChannels sets the channels the player can play.
+func (p *Player) SetChannels(c []Channel) {
+	p.channels = c
+}
+
+// Channels returns the channels the player can play.
+func (p *Player) Channels() []Channel {
+	return p.channels
+}
+
+// Channel returns the channel with the given id.
+func (p *Player) Channel(id string) (*Channel, bool) {
+	return Channels{Channels: p.channels}.Find(id)
+}
+
+// Stream is the stream PickStream picked to play a channel.
+type Stream struct {
+	Channel  string
+	URL      string
+	Fallback *QualityFallback
+}
+
+// PickStream picks the stream to play channel c at quality q: the
+// prefetched one if still fresh, or the first of its URLs that answers. It
+// doesn't talk to mpv, so that the interface can run it in the background,
+// and cancelling ctx abandons the probes.
+func (p *Player) PickStream(ctx context.Context, c Channel, q Quality) (Stream, error) {
+	url, fallback, ok := p.takePrefetched(c.Id, q)
+	if !ok {
+		var err error
+		if url, fallback, err = c.streamURL(ctx, q); err != nil {
+			return Stream{}, err
+		}
+	}
+	return Stream{Channel: c.Id, URL: url, Fallback: fallback}, nil
+}
+
+// PlayStream loads s in mpv and makes sure it is not paused.
+func (p *Player) PlayStream(s Stream) error {
+	if s.Fallback != nil {
+		logger.Warn("falling back to another stream", "channel", s.Channel, "wanted", s.Fallback.Wanted, "got", s.Fallback.Got, "tried", s.Fallback.Tried, "url", s.URL)
+	}
+	logger.Info("playing", "channel", s.Channel, "url", s.URL)
+	if err := p.mpv.Loadfile(s.URL, mpv.LoadFileModeReplace); err != nil {
+		return err
+	}
+	p.playing = s.Channel
+	p.url = s.URL
+	p.fallback = s.Fallback
+	p.reconnects = 0
+	p.publishReconnects()
+	if paused, _ := p.mpv.Pause(); paused {
+		return p.mpv.SetPause(false)
+	}
+	return nil
+}
+
+// Play picks the stream of the channel with the given id and plays it.
+func (p *Player) Play(ctx context.Context, id string) error {
+	c, ok := p.Channel(id)
+	if !ok {
+		return withKind(ErrChannelNotFound, fmt.Errorf("unknown channel %q", id))
+	}
+	s, err := p.PickStream(ctx, *c, p.QualityFor(*c))
+	if err != nil {
+		return err
+	}
+	return p.PlayStream(s)
+}
+
+// Reload reloads the current channel's stream from scratch, for when mpv
+// could not recover from a stall on its own.
+func (p *Player) Reload() error {
+	if p.url == "" {
+		return fmt.Errorf("nothing to reload")
+	}
+	p.reconnects++
+	p.publishReconnects()
+	logger.Warn("reloading stream", "channel", p.playing, "url", p.url, "attempt", p.reconnects)
+	return p.mpv.Loadfile(p.url, mpv.LoadFileModeReplace)
+}
+
+// Fallback describes the stream the current channel fell back to, or is nil
+// if it plays the first stream of the quality asked for.
+func (p *Player) Fallback() *QualityFallback {
+	return p.fallback
+}
+
+// Reconnects returns how many times the current channel had to be reloaded.
+func (p *Player) Reconnects() int {
+	return p.reconnects
+}
+
+// reconnectsProperty keeps the reconnect count in mpv, where other soma
+// processes such as --status can read it. user-data needs mpv 0.36.
+const reconnectsProperty = "user-data/soma/reconnects"
+
+func (p *Player) publishReconnects() {
+	if err := p.mpv.SetProperty(reconnectsProperty, p.reconnects); err != nil {
+		logger.Debug("unable to publish reconnects", "error", err)
+	}
+}
+
+// PublishedReconnects returns the reconnect count recorded in mpv by the soma
+// process driving it, if any.
+func (p *Player) PublishedReconnects() (int, bool) {
+	n, err := p.mpv.GetFloatProperty(reconnectsProperty)
+	if err != nil {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// SetQuality sets the stream quality used by later calls to Play.
+func (p *Player) SetQuality(q Quality) {
+	p.quality = q
+}
+
+// Quality returns the stream quality used by Play for channels without an
+// override.
+func (p *Player) Quality() Quality {
+	return p.quality
+}
+
+// SetQualityOverrides sets the channels played at another quality than the
+// one from SetQuality.
+func (p *Player) SetQualityOverrides(o QualityOverrides) {
+	p.overrides = o
+}
+
+// QualityFor returns the stream quality Play uses for c.
+func (p *Player) QualityFor(c Channel) Quality {
+	if q, ok := p.overrides.For(c); ok {
+		return q
+	}
+	return p.quality
+}
+
+// Pause pauses playback.
+func (p *Player) Pause() error {
+	return p.mpv.SetPause(true)
+}
+
+// Resume resumes playback of the current channel.
+func (p *Player) Resume() error {
+	return p.mpv.SetPause(false)
+}
+
+// Stop unloads the current stream, closing its connection. Play has to load
+// it again.
+func (p *Player) Stop() error {
+	if _, err := p.mpv.Exec("stop"); err != nil {
+		return err
+	}
+	p.playing = ""
+	p.url = ""
+	return nil
+}
+
+// Playing returns the id of the last channel loaded with Play.
+func (p *Player) Playing() string {
+	return p.playing
+}
+
+// GetString returns the value of a string property, without the quoting
+// added by the mpv client.
+func (p *Player) GetString(name string) (string, error) {
+	v, err := p.mpv.GetProperty(name)
+	if err != nil {
+		return "", err
+	}
+	if s, err := strconv.Unquote(v); err == nil {
+		return s, nil
+	}
+	return v, nil
+}
+
+// NowPlaying returns the channel mpv is currently playing, if it is one of
+// the player's channels, and the current media title.
+func (p *Player) NowPlaying() (*Channel, string, error) {
+	path, err := p.GetString("path")
+	if err != nil {
+		return nil, "", err
+	}
+	if path == "" {
+		return nil, "", nil
+	}
+	playlistPath, _ := p.GetString("playlist-path")
+	title, _ := p.GetString("media-title")
+	for i, c := range p.channels {
+		if c.hasURL(path) || (playlistPath != "" && c.hasURL(playlistPath)) {
+			return &p.channels[i], title, nil
+		}
+	}
+	return nil, title, nil
+}
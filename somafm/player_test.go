@@ -0,0 +1,100 @@
+package somafm
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCheckSocketDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix permissions")
+	}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir string) string
+		err   string
+	}{
+		{
+			name: "private directory",
+			setup: func(t *testing.T, dir string) string {
+				return mkdir(t, dir, 0700)
+			},
+		},
+		{
+			name: "group readable",
+			setup: func(t *testing.T, dir string) string {
+				return mkdir(t, dir, 0750)
+			},
+			err: "has mode 0750",
+		},
+		{
+			name: "symlink",
+			setup: func(t *testing.T, dir string) string {
+				link := filepath.Join(dir, "link")
+				if err := os.Symlink(mkdir(t, dir, 0700), link); err != nil {
+					t.Fatal(err)
+				}
+				return link
+			},
+			err: "is a symlink",
+		},
+		{
+			name: "file",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "file")
+				if err := os.WriteFile(path, nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+				return path
+			},
+			err: "is not a directory",
+		},
+		{
+			name: "someone else's",
+			setup: func(t *testing.T, dir string) string {
+				if os.Getuid() != 0 {
+					t.Skip("chown needs root")
+				}
+				sub := mkdir(t, dir, 0700)
+				if err := os.Chown(sub, 12345, 12345); err != nil {
+					t.Fatal(err)
+				}
+				return sub
+			},
+			err: "owned by another user",
+		},
+		{
+			name: "missing",
+			setup: func(t *testing.T, dir string) string {
+				return filepath.Join(dir, "missing")
+			},
+			err: "no such file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSocketDir(tt.setup(t, t.TempDir()))
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func mkdir(t *testing.T, parent string, perm os.FileMode) string {
+	dir := filepath.Join(parent, "sockets")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	// Mkdir's mode is masked by the umask.
+	if err := os.Chmod(dir, perm); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
@@ -0,0 +1,51 @@
+package somafm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ResolveStream returns the audio stream behind the channel's playlist for
+// quality q, falling back to the other qualities like Play does.
+func (c Channel) ResolveStream(ctx context.Context, q Quality) (string, *QualityFallback, error) {
+	playlist, fallback, err := c.streamURL(ctx, q)
+	if err != nil {
+		return "", nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, playlist, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	res, err := probeClient.Do(req)
+	if err != nil {
+		return "", nil, withKind(ErrNetwork, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", nil, withKind(ErrNetwork, fmt.Errorf("%s returned %d", playlist, res.StatusCode))
+	}
+	u, err := parsePLS(res.Body)
+	if err != nil {
+		return "", nil, withKind(ErrNetwork, fmt.Errorf("%s: %w", playlist, err))
+	}
+	return u, fallback, nil
+}
+
+// parsePLS returns the first entry of a PLS playlist.
+func parsePLS(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if ok && strings.HasPrefix(strings.ToLower(key), "file") && value != "" {
+			return value, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("playlist has no stream")
+}
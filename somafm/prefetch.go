@@ -0,0 +1,64 @@
+package somafm
+
+import (
+	"context"
+	"time"
+)
+
+// prefetchTTL is how long a prefetched stream URL is trusted.
+const prefetchTTL = time.Minute
+
+type prefetchedStream struct {
+	id       string
+	quality  Quality
+	url      string
+	fallback *QualityFallback
+	took     time.Duration
+	at       time.Time
+}
+
+// Prefetch picks the stream Play would use for channel c at quality q, so
+// that playing it doesn't wait on probing the stream URLs. Only the latest
+// prefetch is kept. It is safe to call from another goroutine than Play,
+// and cancelling ctx abandons it.
+func (p *Player) Prefetch(ctx context.Context, c Channel, q Quality) error {
+	start := time.Now()
+	url, fallback, err := c.streamURL(ctx, q)
+	if err != nil {
+		return err
+	}
+	p.prefetchMu.Lock()
+	defer p.prefetchMu.Unlock()
+	p.prefetched = prefetchedStream{id: c.Id, quality: q, url: url, fallback: fallback, took: time.Since(start), at: time.Now()}
+	logger.Debug("prefetched stream", "channel", c.Id, "url", url, "took", p.prefetched.took)
+	return nil
+}
+
+// Prefetched reports whether Play would start channel id from a prefetched
+// stream, and how long picking that stream took.
+func (p *Player) Prefetched(id string) (time.Duration, bool) {
+	c, ok := p.Channel(id)
+	if !ok {
+		return 0, false
+	}
+	p.prefetchMu.Lock()
+	defer p.prefetchMu.Unlock()
+	s := p.prefetched
+	if s.id != id || s.quality != p.QualityFor(*c) || time.Since(s.at) > prefetchTTL {
+		return 0, false
+	}
+	return s.took, true
+}
+
+// takePrefetched returns the prefetched stream of channel id, if it is still
+// fresh, and forgets it.
+func (p *Player) takePrefetched(id string, q Quality) (string, *QualityFallback, bool) {
+	p.prefetchMu.Lock()
+	defer p.prefetchMu.Unlock()
+	s := p.prefetched
+	p.prefetched = prefetchedStream{}
+	if s.id != id || s.quality != q || time.Since(s.at) > prefetchTTL {
+		return "", nil, false
+	}
+	return s.url, s.fallback, true
+}
@@ -0,0 +1,146 @@
+package somafm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Quality selects which of a channel's streams to play.
+type Quality string
+
+const (
+	QualityHighest Quality = "highest"
+	QualityFast    Quality = "fast"
+	QualitySlow    Quality = "slow"
+)
+
+// ParseQuality parses a quality name, accepting "high" as a shorthand for
+// "highest".
+func ParseQuality(s string) (Quality, error) {
+	switch s {
+	case "highest", "high":
+		return QualityHighest, nil
+	case "fast":
+		return QualityFast, nil
+	case "slow":
+		return QualitySlow, nil
+	}
+	return "", fmt.Errorf("unknown quality %q, expected highest, fast or slow", s)
+}
+
+// StreamURLs returns the channel's playlist URLs, those of quality q first and
+// the other qualities after as fallbacks. A channel may list zero, one or
+// several fast streams, and any field may be empty; empty URLs are skipped.
+func (c Channel) StreamURLs(q Quality) []string {
+	var order [][]string
+	highest := []string{c.HighestURL}
+	slow := []string{c.SlowURL}
+	switch q {
+	case QualityFast:
+		order = [][]string{c.FastURL, highest, slow}
+	case QualitySlow:
+		order = [][]string{slow, c.FastURL, highest}
+	default:
+		order = [][]string{highest, c.FastURL, slow}
+	}
+
+	var urls []string
+	for _, group := range order {
+		for _, u := range group {
+			if u != "" {
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls
+}
+
+var probeClient = &http.Client{Timeout: 3 * time.Second}
+
+func reachable(ctx context.Context, u string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return false
+	}
+	res, err := probeClient.Do(req)
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode < 400
+}
+
+// QualityFallback describes a stream played instead of the preferred one,
+// because the streams before it didn't answer.
+type QualityFallback struct {
+	Channel string
+	Wanted  Quality
+	Got     Quality
+	Tried   []string
+	URL     string
+}
+
+// QualityOf returns the quality of the channel's stream u.
+func (c Channel) QualityOf(u string) Quality {
+	switch {
+	case u == c.SlowURL:
+		return QualitySlow
+	case slices.Contains(c.FastURL, u):
+		return QualityFast
+	default:
+		return QualityHighest
+	}
+}
+
+// streamURL picks the first reachable URL among the channel's streams for
+// quality q, and describes the fallback if that isn't the first one. If none
+// answer, the first one is returned and mpv gets to report the error.
+func (c Channel) streamURL(ctx context.Context, q Quality) (string, *QualityFallback, error) {
+	urls := c.StreamURLs(q)
+	if len(urls) == 0 {
+		return "", nil, fmt.Errorf("channel %s has no stream", c.Id)
+	}
+	if len(urls) == 1 {
+		return urls[0], nil, nil
+	}
+	for i, u := range urls {
+		if reachable(ctx, u) {
+			if i == 0 {
+				return u, nil, nil
+			}
+			return u, &QualityFallback{Channel: c.Id, Wanted: q, Got: c.QualityOf(u), Tried: urls[:i], URL: u}, nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	return urls[0], nil, nil
+}
+
+// QualityOverrides sets the quality of some channels apart from the player's,
+// by channel id first, then by genre. Genres match any of the channel's
+// genres, whatever their case.
+type QualityOverrides struct {
+	Channels map[string]Quality
+	Genres   map[string]Quality
+}
+
+// For returns the quality the overrides set for c, if any.
+func (o QualityOverrides) For(c Channel) (Quality, bool) {
+	if q, ok := o.Channels[c.Id]; ok {
+		return q, true
+	}
+	for _, genre := range strings.Split(c.Genre, "|") {
+		genre = strings.TrimSpace(genre)
+		for g, q := range o.Genres {
+			if strings.EqualFold(strings.TrimSpace(g), genre) {
+				return q, true
+			}
+		}
+	}
+	return "", false
+}
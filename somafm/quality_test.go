@@ -0,0 +1,183 @@
+package somafm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestStreamURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel Channel
+		q       Quality
+		want    []string
+	}{
+		{
+			name:    "no fast stream",
+			channel: Channel{HighestURL: "h", SlowURL: "s"},
+			q:       QualityFast,
+			want:    []string{"h", "s"},
+		},
+		{
+			name:    "one fast stream",
+			channel: Channel{HighestURL: "h", FastURL: []string{"f"}, SlowURL: "s"},
+			q:       QualityFast,
+			want:    []string{"f", "h", "s"},
+		},
+		{
+			name:    "several fast streams",
+			channel: Channel{HighestURL: "h", FastURL: []string{"f1", "f2"}, SlowURL: "s"},
+			q:       QualityFast,
+			want:    []string{"f1", "f2", "h", "s"},
+		},
+		{
+			name:    "highest",
+			channel: Channel{HighestURL: "h", FastURL: []string{"f1", "f2"}, SlowURL: "s"},
+			q:       QualityHighest,
+			want:    []string{"h", "f1", "f2", "s"},
+		},
+		{
+			name:    "slow",
+			channel: Channel{HighestURL: "h", FastURL: []string{"f1", "f2"}, SlowURL: "s"},
+			q:       QualitySlow,
+			want:    []string{"s", "f1", "f2", "h"},
+		},
+		{
+			name:    "empty fields",
+			channel: Channel{FastURL: []string{"", "f"}},
+			q:       QualityHighest,
+			want:    []string{"f"},
+		},
+		{
+			name: "no stream",
+			q:    QualityHighest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.channel.StreamURLs(tt.q); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamURL(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	tests := []struct {
+		name     string
+		channel  Channel
+		q        Quality
+		want     string
+		fallback *QualityFallback
+		err      bool
+	}{
+		{
+			name:    "preferred answers",
+			channel: Channel{Id: "c", HighestURL: up.URL + "/h", FastURL: []string{failing.URL + "/f"}},
+			q:       QualityHighest,
+			want:    up.URL + "/h",
+		},
+		{
+			name:    "next fast stream",
+			channel: Channel{Id: "c", HighestURL: up.URL + "/h", FastURL: []string{down.URL + "/f1", up.URL + "/f2"}},
+			q:       QualityFast,
+			want:    up.URL + "/f2",
+			fallback: &QualityFallback{Channel: "c", Wanted: QualityFast, Got: QualityFast,
+				Tried: []string{down.URL + "/f1"}, URL: up.URL + "/f2"},
+		},
+		{
+			name:    "other quality",
+			channel: Channel{Id: "c", HighestURL: failing.URL + "/h", FastURL: []string{down.URL + "/f"}, SlowURL: up.URL + "/s"},
+			q:       QualityHighest,
+			want:    up.URL + "/s",
+			fallback: &QualityFallback{Channel: "c", Wanted: QualityHighest, Got: QualitySlow,
+				Tried: []string{failing.URL + "/h", down.URL + "/f"}, URL: up.URL + "/s"},
+		},
+		{
+			name:    "none answers",
+			channel: Channel{Id: "c", HighestURL: failing.URL + "/h", SlowURL: down.URL + "/s"},
+			q:       QualitySlow,
+			want:    down.URL + "/s",
+		},
+		{
+			name:    "single stream is not probed",
+			channel: Channel{Id: "c", HighestURL: down.URL + "/h"},
+			q:       QualityFast,
+			want:    down.URL + "/h",
+		},
+		{
+			name:    "no stream",
+			channel: Channel{Id: "c"},
+			q:       QualityHighest,
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fallback, err := tt.channel.streamURL(context.Background(), tt.q)
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, want error %t", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if !equalFallbacks(fallback, tt.fallback) {
+				t.Errorf("fallback %+v, want %+v", fallback, tt.fallback)
+			}
+		})
+	}
+}
+
+func TestStreamURLCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := Channel{Id: "c", HighestURL: "http://127.0.0.1:1/h", SlowURL: "http://127.0.0.1:1/s"}
+	if _, _, err := c.streamURL(ctx, QualityHighest); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func equalFallbacks(a, b *QualityFallback) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Channel == b.Channel && a.Wanted == b.Wanted && a.Got == b.Got &&
+		slices.Equal(a.Tried, b.Tried) && a.URL == b.URL
+}
+
+func TestQualityOverridesFor(t *testing.T) {
+	o := QualityOverrides{
+		Channels: map[string]Quality{"groovesalad": QualitySlow},
+		Genres:   map[string]Quality{" Ambient ": QualityFast},
+	}
+	tests := []struct {
+		name    string
+		channel Channel
+		want    Quality
+		ok      bool
+	}{
+		{"by id", Channel{Id: "groovesalad", Genre: "ambient"}, QualitySlow, true},
+		{"by genre", Channel{Id: "dronezone", Genre: "electronic|AMBIENT"}, QualityFast, true},
+		{"none", Channel{Id: "lush", Genre: "electronica"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := o.For(tt.channel)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got %q, %t, want %q, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package somafm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchCount returns how many of the query tokens start one of the field's
+// tokens, so that "space" finds "spacey".
+func matchCount(query []string, field string) int {
+	tokens := tokenize(field)
+	n := 0
+	for _, q := range query {
+		if slices.ContainsFunc(tokens, func(t string) bool { return strings.HasPrefix(t, q) }) {
+			n++
+		}
+	}
+	return n
+}
+
+// Score rates how relevant the channel is to the query, by token overlap
+// with its title, genre, DJ and description. Title and genre matches weigh
+// more than the free-form fields.
+func (c Channel) Score(query string) int {
+	q := tokenize(query)
+	return 3*matchCount(q, c.ChannelTitle) +
+		2*matchCount(q, c.Genre) +
+		matchCount(q, c.DJ) +
+		matchCount(q, c.ChannelDescription)
+}
+
+// Search returns the channels relevant to the query, most relevant first.
+func Search(channels []Channel, query string) []Channel {
+	type result struct {
+		channel Channel
+		score   int
+	}
+	var results []result
+	for _, c := range channels {
+		if score := c.Score(query); score > 0 {
+			results = append(results, result{c, score})
+		}
+	}
+	slices.SortStableFunc(results, func(a, b result) int { return b.score - a.score })
+
+	ranked := make([]Channel, len(results))
+	for i, r := range results {
+		ranked[i] = r.channel
+	}
+	return ranked
+}
+
+// Resolve finds the channel a user means by query: the channel with that
+// id, or else the one whose id and title match the most query tokens, the
+// same way Search matches them. A tie between several channels is an error
+// listing them.
+func Resolve(channels []Channel, query string) (*Channel, error) {
+	for i := range channels {
+		if strings.EqualFold(channels[i].Id, query) {
+			return &channels[i], nil
+		}
+	}
+
+	q := tokenize(query)
+	best, bestScore := []int(nil), 0
+	for i, c := range channels {
+		score := matchCount(q, c.Id) + matchCount(q, c.ChannelTitle)
+		switch {
+		case score == 0 || score < bestScore:
+		case score > bestScore:
+			best, bestScore = []int{i}, score
+		default:
+			best = append(best, i)
+		}
+	}
+
+	switch len(best) {
+	case 0:
+		return nil, withKind(ErrChannelNotFound, fmt.Errorf("no channel matches %q", query))
+	case 1:
+		return &channels[best[0]], nil
+	}
+	candidates := make([]string, len(best))
+	for i, b := range best {
+		candidates[i] = fmt.Sprintf("%s (%s)", channels[b].Id, channels[b].ChannelTitle)
+	}
+	return nil, withKind(ErrAmbiguousChannel, fmt.Errorf("%q matches several channels: %s", query, strings.Join(candidates, ", ")))
+}
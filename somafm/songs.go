@@ -0,0 +1,117 @@
+package somafm
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// songsURL is where FetchSongs gets a channel's songs, a variable for tests.
+var songsURL = "https://somafm.com/songs/%s.xml"
+
+// Song is an entry of a channel's recently played list.
+type Song struct {
+	Title  string `xml:"title"`
+	Artist string `xml:"artist"`
+	Album  string `xml:"album"`
+	Date   int64  `xml:"date"`
+}
+
+func (s Song) String() string {
+	if s.Artist == "" {
+		return s.Title
+	}
+	return fmt.Sprintf("%s – %s", s.Artist, s.Title)
+}
+
+// FetchSongs downloads the songs recently played on a channel, the current
+// one first.
+func FetchSongs(ctx context.Context, id string) ([]Song, error) {
+	url := fmt.Sprintf(songsURL, id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("fetching songs", "url", url)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, withKind(ErrNetwork, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, withKind(ErrNetwork, fmt.Errorf("somafm returned %d", res.StatusCode))
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, withKind(ErrNetwork, err)
+	}
+
+	var songs struct {
+		Songs []Song `xml:"song"`
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(&songs); err != nil {
+		return nil, withKind(ErrNetwork, err)
+	}
+	return songs.Songs, nil
+}
+
+// FetchNowPlaying fetches the current song of each of the given channels.
+// At most workers requests are in flight and a new one starts at most every
+// interval, to go easy on SomaFM. Channels whose feed fails are left out
+// and logged.
+func FetchNowPlaying(ctx context.Context, ids []string, workers int, interval time.Duration) map[string]Song {
+	jobs := make(chan string)
+	throttle := time.NewTicker(interval)
+	defer throttle.Stop()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	playing := make(map[string]Song, len(ids))
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				songs, err := FetchSongs(ctx, id)
+				if err != nil {
+					logger.Warn("fetching songs", "channel", id, "error", err)
+					continue
+				}
+				if len(songs) == 0 {
+					continue
+				}
+				mu.Lock()
+				playing[id] = songs[0]
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+			break feed
+		case <-throttle.C:
+		}
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- id:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return playing
+}
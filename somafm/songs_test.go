@@ -0,0 +1,73 @@
+package somafm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// songsServer serves the songs of groovesalad, none for empty, and an error
+// for any other channel.
+func songsServer(t *testing.T, h http.HandlerFunc) {
+	t.Helper()
+	if h == nil {
+		h = func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/groovesalad.xml":
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><songs>
+					<song><title>Dayvan Cowboy</title><artist>Boards of Canada</artist><date>2</date></song>
+					<song><title>Roygbiv</title><artist>Boards of Canada</artist><date>1</date></song>
+					</songs>`)
+			case "/empty.xml":
+				fmt.Fprint(w, `<songs></songs>`)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	old := songsURL
+	songsURL = srv.URL + "/%s.xml"
+	t.Cleanup(func() { songsURL = old })
+}
+
+func TestFetchNowPlaying(t *testing.T) {
+	songsServer(t, nil)
+	playing := FetchNowPlaying(context.Background(), []string{"groovesalad", "empty", "broken"}, 2, time.Millisecond)
+	if len(playing) != 1 {
+		t.Errorf("got %v, want groovesalad only", playing)
+	}
+	if got, want := playing["groovesalad"].String(), "Boards of Canada – Dayvan Cowboy"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// Cancelling stops the fetches in flight and the workers with them, which
+// FetchNowPlaying waits for before returning.
+func TestFetchNowPlayingCancelled(t *testing.T) {
+	started := make(chan struct{}, 10)
+	songsServer(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan map[string]Song)
+	go func() {
+		done <- FetchNowPlaying(ctx, []string{"a", "b", "c", "d"}, 2, time.Millisecond)
+	}()
+	<-started
+	cancel()
+	select {
+	case playing := <-done:
+		if len(playing) != 0 {
+			t.Errorf("got %v, want nothing", playing)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("still fetching after cancel")
+	}
+}
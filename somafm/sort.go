@@ -0,0 +1,134 @@
+package somafm
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SortMode is a criterion for ordering channel lists.
+type SortMode string
+
+const (
+	SortDefault   SortMode = ""
+	SortTitle     SortMode = "title"
+	SortGenre     SortMode = "genre"
+	SortListeners SortMode = "listeners"
+	SortFavorites SortMode = "favorites"
+)
+
+// SortModes lists the sort modes in the order the TUI cycles through them.
+var SortModes = []SortMode{SortDefault, SortTitle, SortGenre, SortListeners, SortFavorites}
+
+// ParseSortMode parses a sort mode name, "default" meaning SomaFM's order.
+func ParseSortMode(s string) (SortMode, error) {
+	if s == "default" {
+		return SortDefault, nil
+	}
+	for _, m := range SortModes {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown sort mode %q", s)
+}
+
+func (m SortMode) String() string {
+	if m == SortDefault {
+		return "default"
+	}
+	return string(m)
+}
+
+// SortOrder is a list of sort modes applied in turn, each one ordering the
+// channels the previous ones consider equal, e.g. favorites first and then
+// by listeners. A single mode is the simple case.
+type SortOrder []SortMode
+
+// ParseSortOrder parses comma-separated sort mode names.
+func ParseSortOrder(s string) (SortOrder, error) {
+	var order SortOrder
+	for _, name := range strings.Split(s, ",") {
+		mode, err := ParseSortMode(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		if mode != SortDefault {
+			order = append(order, mode)
+		}
+	}
+	return order, nil
+}
+
+func (o SortOrder) String() string {
+	if len(o) == 0 {
+		return SortDefault.String()
+	}
+	names := make([]string, len(o))
+	for i, m := range o {
+		names[i] = m.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// UnmarshalJSON accepts a list of modes, or a single mode as saved by older
+// versions.
+func (o *SortOrder) UnmarshalJSON(b []byte) error {
+	var mode SortMode
+	if err := json.Unmarshal(b, &mode); err == nil {
+		*o = nil
+		if mode != SortDefault {
+			*o = SortOrder{mode}
+		}
+		return nil
+	}
+	var modes []SortMode
+	if err := json.Unmarshal(b, &modes); err != nil {
+		return err
+	}
+	*o = modes
+	return nil
+}
+
+func (m SortMode) compare(a, b Channel, favorites []string) int {
+	switch m {
+	case SortTitle:
+		return strings.Compare(strings.ToLower(a.ChannelTitle), strings.ToLower(b.ChannelTitle))
+	case SortGenre:
+		return strings.Compare(strings.ToLower(a.Genre), strings.ToLower(b.Genre))
+	case SortListeners:
+		return cmp.Compare(b.Listeners, a.Listeners)
+	case SortFavorites:
+		// Favorites come first, in the user's order.
+		i, j := slices.Index(favorites, a.Id), slices.Index(favorites, b.Id)
+		if i < 0 {
+			i = len(favorites)
+		}
+		if j < 0 {
+			j = len(favorites)
+		}
+		return cmp.Compare(i, j)
+	}
+	return 0
+}
+
+// SortChannels returns a copy of the channels in the given order. Channels
+// the order considers equal, and all of them for an empty order, keep
+// SomaFM's order. favorites is only used by SortFavorites.
+func SortChannels(c []Channel, order SortOrder, favorites []string) []Channel {
+	sorted := slices.Clone(c)
+	if len(order) == 0 {
+		return sorted
+	}
+	slices.SortStableFunc(sorted, func(a, b Channel) int {
+		for _, m := range order {
+			if n := m.compare(a, b, favorites); n != 0 {
+				return n
+			}
+		}
+		return 0
+	})
+	return sorted
+}
@@ -0,0 +1,34 @@
+package somafm
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestSortOrderUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want SortOrder
+		err  bool
+	}{
+		{`["favorites", "listeners"]`, SortOrder{SortFavorites, SortListeners}, false},
+		{`[]`, SortOrder{}, false},
+		// A single mode, as sortMode was first saved.
+		{`"title"`, SortOrder{SortTitle}, false},
+		{`""`, nil, false},
+		{`3`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var got SortOrder
+			err := json.Unmarshal([]byte(tt.in), &got)
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, want error %t", err, tt.err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package somafm
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// MinMpvVersion is the oldest mpv release known to behave as the player
+// expects over IPC.
+const MinMpvVersion = "0.33.0"
+
+// parseMpvVersion extracts the numeric version from mpv's version string,
+// e.g. "mpv v0.38.0-386-gdeadbeef" gives [0 38 0].
+func parseMpvVersion(s string) ([]int, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "mpv ")
+	s = strings.TrimPrefix(s, "v")
+	end := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end >= 0 {
+		s = s[:end]
+	}
+	var parts []int
+	for _, field := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("unrecognized mpv version %q", s)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+func compareVersions(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// checkMpvVersion returns an error if version is older than MinMpvVersion.
+func checkMpvVersion(version string) error {
+	v, err := parseMpvVersion(version)
+	if err != nil {
+		return err
+	}
+	minimum, _ := parseMpvVersion(MinMpvVersion)
+	if compareVersions(v, minimum) < 0 {
+		return fmt.Errorf("%s is older than the minimum supported mpv %s, some features may not work", version, MinMpvVersion)
+	}
+	return nil
+}
+
+// MpvVersion returns the version reported by the connected mpv.
+func (p *Player) MpvVersion() (string, error) {
+	return p.GetString("mpv-version")
+}
+
+// CheckMpvVersion returns an error if the connected mpv is older than
+// MinMpvVersion.
+func (p *Player) CheckMpvVersion() error {
+	version, err := p.MpvVersion()
+	if err != nil {
+		return fmt.Errorf("unable to get mpv version: %s", err)
+	}
+	return checkMpvVersion(version)
+}
+
+// InstalledMpvVersion returns the version of the mpv binary in PATH.
+func InstalledMpvVersion() (string, error) {
+	out, err := exec.Command("mpv", "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", fmt.Errorf("unrecognized mpv --version output")
+	}
+	return strings.Join(fields[:2], " "), nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+type theme struct {
+	statusMessage      lipgloss.Style
+	title              lipgloss.Style
+	paginationActive   lipgloss.Style
+	paginationInactive lipgloss.Style
+	cursor             lipgloss.Style
+	section            lipgloss.Style
+	playingGlyph       string
+}
+
+var themes = map[string]theme{
+	"default": {
+		statusMessage: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#00FF00")),
+		title: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FFFDF5")).
+			Bold(true),
+		paginationActive: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#00AA00")).
+			Bold(true),
+		paginationInactive: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#909090")),
+		cursor: lipgloss.NewStyle().
+			Bold(true).
+			Padding(0, 0, 0, 1).
+			Foreground(lipgloss.Color("#00FF00")),
+		section: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#00AA00")).
+			Bold(true),
+		playingGlyph: "♫",
+	},
+	// high-contrast sticks to bright white and marks the selection and the
+	// playing channel with glyphs, so nothing relies on color alone.
+	"high-contrast": {
+		statusMessage: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("15")).
+			Bold(true),
+		title: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("15")).
+			Bold(true).
+			Underline(true),
+		paginationActive: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("15")).
+			Bold(true),
+		paginationInactive: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("7")),
+		cursor: lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("15")).
+			Border(lipgloss.Border{Left: ">"}, false, false, false, true).
+			BorderForeground(lipgloss.Color("15")),
+		section: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("15")).
+			Bold(true).
+			Underline(true),
+		playingGlyph: "▶",
+	},
+}
+
+var (
+	docStyle           = lipgloss.NewStyle().Margin(1, 1)
+	statusMessageStyle = themes["default"].statusMessage.Render
+	titleStyle         = themes["default"].title
+
+	paginationActiveStyle   = themes["default"].paginationActive
+	paginationInactiveStyle = themes["default"].paginationInactive
+
+	cursorStyle  = themes["default"].cursor
+	sectionStyle = themes["default"].section
+	playingGlyph = themes["default"].playingGlyph
+)
+
+// applyTheme switches the TUI styles to the named theme. It has to be called
+// before the model is built.
+func applyTheme(name string) error {
+	if name == "" {
+		name = "default"
+	}
+	t, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q", name)
+	}
+	statusMessageStyle = t.statusMessage.Render
+	titleStyle = t.title
+	paginationActiveStyle = t.paginationActive
+	paginationInactiveStyle = t.paginationInactive
+	cursorStyle = t.cursor
+	sectionStyle = t.section
+	playingGlyph = t.playingGlyph
+	return nil
+}
+
+// liteItems makes the list one line per channel, see applyLite.
+var liteItems bool
+
+// applyLite strips the styles down to what a slow terminal redraws quickly:
+// one line per channel, no colors, and > for the cursor. It is applied over
+// the theme, before the model is built.
+func applyLite() {
+	liteItems = true
+	plain := lipgloss.NewStyle()
+	statusMessageStyle = plain.Render
+	titleStyle = plain.Bold(true)
+	paginationActiveStyle = plain
+	paginationInactiveStyle = plain
+	sectionStyle = plain
+	cursorStyle = plain.Border(lipgloss.Border{Left: ">"}, false, false, false, true).PaddingLeft(1)
+}
+
+// liteFPS caps how often the interface is redrawn in lite mode, down from
+// bubbletea's 60 frames per second.
+const liteFPS = 10
+
+// glyphs overrides the theme's marks for the playing channel and the cursor,
+// for fonts that lack them.
+type glyphs struct {
+	Playing string `json:"playing"`
+	Cursor  string `json:"cursor"`
+}
+
+// fallbackGlyph replaces glyphs that take no room on screen.
+const fallbackGlyph = ">"
+
+// applyGlyphs switches the theme's glyphs to the configured ones, after
+// applyTheme. A glyph the terminal would draw as nothing is replaced with
+// fallbackGlyph, and reported.
+func applyGlyphs(g glyphs) error {
+	var err error
+	for _, glyph := range []*string{&g.Playing, &g.Cursor} {
+		if *glyph != "" && runewidth.StringWidth(*glyph) == 0 {
+			err = fmt.Errorf("glyph %q is zero-width, using %q", *glyph, fallbackGlyph)
+			*glyph = fallbackGlyph
+		}
+	}
+	if g.Playing != "" {
+		playingGlyph = g.Playing
+	}
+	if g.Cursor != "" {
+		// The default delegate indents unselected items by 2 cells.
+		cursorStyle = cursorStyle.
+			Border(lipgloss.Border{Left: g.Cursor}, false, false, false, true).
+			BorderForeground(cursorStyle.GetForeground()).
+			PaddingLeft(max(2-runewidth.StringWidth(g.Cursor), 0))
+	}
+	return err
+}
+
+// newDocStyle builds the style framing the interface from the margin and
+// padding set in the config, each given as 1 to 4 values like in CSS. An
+// unset margin keeps the default of one cell around the list.
+func newDocStyle(margin, padding []int) (lipgloss.Style, error) {
+	if margin == nil {
+		margin = []int{1, 1}
+	}
+	for name, values := range map[string][]int{"margin": margin, "padding": padding} {
+		if len(values) > 4 {
+			return docStyle, fmt.Errorf("%s: at most 4 values, got %d", name, len(values))
+		}
+		for _, v := range values {
+			if v < 0 {
+				return docStyle, fmt.Errorf("%s: %d is negative", name, v)
+			}
+		}
+	}
+	style := lipgloss.NewStyle()
+	if len(margin) > 0 {
+		style = style.Margin(margin...)
+	}
+	if len(padding) > 0 {
+		style = style.Padding(padding...)
+	}
+	return style, nil
+}
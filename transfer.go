@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+)
+
+// transientFields are the settings tied to this machine or session, which
+// --export leaves out and --import ignores.
+var transientFields = []string{
+	"currentlyPlaying",
+	"isPaused",
+	"channels",
+	"lastChannelsListUpdate",
+	"selected",
+	"recent",
+	"audioDevice",
+}
+
+// portableFields returns the config as JSON fields, without the transient
+// ones.
+func portableFields(data []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	for _, name := range transientFields {
+		delete(fields, name)
+	}
+	return fields, nil
+}
+
+// exportConfig writes the favorites, aliases, notes and preferences to path.
+func exportConfig(config *somaConfig, path string) error {
+	config.ConfigVersion = configVersion
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	fields, err := portableFields(data)
+	if err != nil {
+		return err
+	}
+	if data, err = json.MarshalIndent(fields, "", "  "); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d favorites, %d aliases and %d notes to %s\n", len(config.Favorites), len(config.Aliases), len(config.Notes), path)
+	return nil
+}
+
+// importConfig reads a file written by --export. Favorites, watches and the
+// entries of aliases, notes, presets and keys are added to the local ones,
+// which win on conflicts, and the local preferences are kept. With force,
+// everything in the file replaces the local settings.
+func importConfig(config *somaConfig, path string, force bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if data, err = migrateConfig(data); err != nil {
+		return fmt.Errorf("%w %s: %w", errConfigInvalid, path, err)
+	}
+	fields, err := portableFields(data)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", errConfigInvalid, path, err)
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return err
+	}
+	imported := defaultConfig()
+	if err := json.Unmarshal(data, imported); err != nil {
+		return fmt.Errorf("%w %s: %w", errConfigInvalid, path, err)
+	}
+	if err := imported.validate(); err != nil {
+		return fmt.Errorf("%w %s: %w", errConfigInvalid, path, err)
+	}
+
+	var merged *somaConfig
+	if force {
+		merged, err = replaceFields(config, fields)
+		if err != nil {
+			return err
+		}
+	} else {
+		merged = config
+		mergeConfig(merged, imported)
+	}
+	if err := merged.validate(); err != nil {
+		return fmt.Errorf("%w: after importing %s: %w", errConfigInvalid, path, err)
+	}
+	if err := merged.saveConfig(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d favorites, %d aliases and %d notes from %s\n", len(imported.Favorites), len(imported.Aliases), len(imported.Notes), path)
+	if !force {
+		fmt.Println("Local preferences were kept, use --force to replace them too.")
+	}
+	return nil
+}
+
+// replaceFields returns config with the given JSON fields replaced.
+func replaceFields(config *somaConfig, fields map[string]json.RawMessage) (*somaConfig, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var current map[string]json.RawMessage
+	if err := json.Unmarshal(data, &current); err != nil {
+		return nil, err
+	}
+	maps.Copy(current, fields)
+	if data, err = json.Marshal(current); err != nil {
+		return nil, err
+	}
+	replaced := defaultConfig()
+	if err := json.Unmarshal(data, replaced); err != nil {
+		return nil, err
+	}
+	return replaced, nil
+}
+
+// mergeConfig adds the favorites, watches, aliases, notes, presets and key
+// bindings of imported that config doesn't have.
+func mergeConfig(config, imported *somaConfig) {
+	for _, id := range imported.Favorites {
+		config.addFavorite(id)
+	}
+	for _, w := range imported.Watches {
+		if !slices.Contains(config.Watches, w) {
+			config.Watches = append(config.Watches, w)
+		}
+	}
+	config.Aliases = mergeMissing(config.Aliases, imported.Aliases)
+	config.Notes = mergeMissing(config.Notes, imported.Notes)
+	config.Presets = mergeMissing(config.Presets, imported.Presets)
+	config.Keys = mergeMissing(config.Keys, imported.Keys)
+	config.QualityByChannel = mergeMissing(config.QualityByChannel, imported.QualityByChannel)
+	config.QualityByGenre = mergeMissing(config.QualityByGenre, imported.QualityByGenre)
+	config.Categories = mergeMissing(config.Categories, imported.Categories)
+}
+
+// mergeMissing adds the entries of from whose keys to doesn't have.
+func mergeMissing[V any](to, from map[string]V) map[string]V {
+	for k, v := range from {
+		if _, ok := to[k]; ok {
+			continue
+		}
+		if to == nil {
+			to = map[string]V{}
+		}
+		to[k] = v
+	}
+	return to
+}
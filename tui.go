@@ -0,0 +1,2146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+
+	mpv "github.com/nbr23/go-mpv"
+	"github.com/nbr23/soma/somafm"
+)
+
+type channel struct {
+	somafm.Channel
+	IsFavorite bool
+	NowPlaying string
+	Note       string
+}
+
+func (c channel) FilterValue() string {
+	return fmt.Sprintf("%s %s %s", c.Id, c.ChannelDescription, c.Note)
+}
+func (c channel) Title() string {
+	if c.IsFavorite {
+		return fmt.Sprintf("%s ★", c.ChannelTitle)
+	}
+	return c.ChannelTitle
+}
+func (c channel) Description() string {
+	genre := c.Genre
+	if c.Note != "" {
+		genre = fmt.Sprintf("%s | ✎ %s", genre, c.Note)
+	}
+	if c.NowPlaying != "" {
+		return fmt.Sprintf("%s | ♫ %s", genre, c.NowPlaying)
+	}
+	return fmt.Sprintf("%s | %s", genre, c.ChannelDescription)
+}
+
+// surfDelay is how long n/p wait for another press before loading the
+// channel they landed on, so that flipping through channels doesn't hammer
+// mpv with reloads.
+const surfDelay = 400 * time.Millisecond
+
+// whatsOnTTL is how long the what's on board is reused before w fetches the
+// song feeds again. whatsOnWorkers and whatsOnInterval bound how hard the
+// fetch hits SomaFM.
+const (
+	whatsOnTTL      = 2 * time.Minute
+	whatsOnWorkers  = 4
+	whatsOnInterval = 100 * time.Millisecond
+)
+
+// watchFlashDuration is how long the title bar stays highlighted when a
+// watched artist comes on.
+const watchFlashDuration = 2 * time.Second
+
+// prefetchDelay is how long the cursor has to rest on a channel before its
+// stream is prefetched.
+const prefetchDelay = 300 * time.Millisecond
+
+// rebufferTimeout is how long a stalled stream gets to recover from mpv's
+// cache before it is reloaded.
+const rebufferTimeout = 10 * time.Second
+
+type model struct {
+	playing        string
+	player         *somafm.Player
+	quitting       bool
+	config         *somaConfig
+	list           list.Model
+	bufferingSince time.Time
+	cacheStalled   bool
+	favoritesView  bool
+	searching      bool
+	searchInput    textinput.Model
+	searchQuery    string
+	searchResults  []somafm.Channel
+	width          int
+	height         int
+	saveErr        error
+	mpvExited      bool
+	mpvExitErr     error
+	surfSeq        int
+	trackStarted   time.Time
+	clockTicking   bool
+	presetName     string
+	category       string
+	title          string
+	streamInfo     somafm.StreamInfo
+	sampler        []somafm.Channel
+	sampleIndex    int
+	sampleEnds     time.Time
+	sampleSeq      int
+	keepPlaying    bool
+	ctx            context.Context
+	whatsOn        map[string]somafm.Song
+	whatsOnFetched time.Time
+	fetchingOn     bool
+	refreshing     bool
+	keys           keymap
+	prefetchID     string
+	editingNote    string
+	noteInput      textinput.Model
+	quietIndex     int
+	quietRestore   float64
+	quietCap       float64
+	showDetails    bool
+	onBattery      bool
+	volume         float64
+	muted          bool
+	volumeKnown    bool
+	volumeHinted   bool
+	pausedAt       time.Time
+	pauseSeq       int
+	stoppedPaused  bool
+	streamWanted   string
+	markedPlaying  string
+	streamSeq      int
+	mpris          *mprisServer
+	artwork        *somafm.ArtworkCache
+	artworkURL     string
+	artworkPath    string
+	web            *webServer
+	lite           bool
+	queued         string
+	details        viewport.Model
+	detailsID      string
+	untilEnd       bool
+	streamStarted  bool
+	prefetchSeq    int
+	prefetchCancel context.CancelFunc
+	attached       bool
+	titleSeq       int
+	switching      bool
+	switchRecent   bool
+	showingLog     bool
+}
+
+type currentTitleUpdateMsg struct {
+	title string
+}
+
+// titleSettledMsg carries a media-title that wasn't replaced by another one
+// within the debounce interval.
+type titleSettledMsg struct {
+	seq   int
+	title string
+}
+
+type flashDoneMsg struct{}
+
+type metadataMsg struct {
+	info somafm.StreamInfo
+}
+
+type changePausedStatusMsg struct {
+	paused bool
+}
+
+type clockTickMsg struct{}
+
+// clockTick schedules the next clock update, every second or, in lite mode,
+// every minute.
+func (m *model) clockTick() tea.Cmd {
+	interval := time.Second
+	if m.lite {
+		interval = time.Minute
+	}
+	return tea.Every(interval, func(time.Time) tea.Msg {
+		return clockTickMsg{}
+	})
+}
+
+// mpvExitedMsg reports that the mpv soma started went away, which ends the
+// interface: main prints why.
+type mpvExitedMsg struct {
+	err error
+}
+
+type sampleTickMsg struct {
+	seq int
+}
+
+func sampleTick(seq int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return sampleTickMsg{seq: seq}
+	})
+}
+
+type whatsOnMsg struct {
+	songs map[string]somafm.Song
+}
+
+// fetchWhatsOn fetches the current song of every channel in the background.
+func fetchWhatsOn(ctx context.Context, channels []somafm.Channel) tea.Cmd {
+	ids := make([]string, len(channels))
+	for i, c := range channels {
+		ids[i] = c.Id
+	}
+	return func() tea.Msg {
+		return whatsOnMsg{songs: somafm.FetchNowPlaying(ctx, ids, whatsOnWorkers, whatsOnInterval)}
+	}
+}
+
+type channelsMsg struct {
+	channels   *somafm.Channels
+	err        error
+	background bool
+}
+
+// artworkMsg reports the playing channel's image downloaded to the cache.
+type artworkMsg struct {
+	url  string
+	path string
+	err  error
+}
+
+// fetchArtwork downloads the playing channel's image, once per image, for
+// the MPRIS clients to show from the cache.
+func (m *model) fetchArtwork() tea.Cmd {
+	if m.artwork == nil || !m.mpris.registered() {
+		return nil
+	}
+	c, ok := m.playingChannel()
+	if !ok || c.ArtworkURL() == "" || c.ArtworkURL() == m.artworkURL {
+		return nil
+	}
+	m.artworkURL, m.artworkPath = c.ArtworkURL(), ""
+	ctx, cache, url := m.ctx, m.artwork, m.artworkURL
+	return func() tea.Msg {
+		path, err := cache.Get(ctx, url)
+		return artworkMsg{url: url, path: path, err: err}
+	}
+}
+
+// fetchChannels fetches the channel list in the background. background
+// marks the refresh started on its own at startup, rather than with R.
+func fetchChannels(ctx context.Context, background bool) tea.Cmd {
+	return func() tea.Msg {
+		channels, err := fetchChannelList(ctx)
+		return channelsMsg{channels: channels, err: err, background: background}
+	}
+}
+
+// diffChannels returns the ids of the channels in next but not in prev, and
+// those in prev but not in next.
+func diffChannels(prev, next []somafm.Channel) (added, removed []string) {
+	ids := func(c []somafm.Channel) map[string]bool {
+		m := make(map[string]bool, len(c))
+		for _, ch := range c {
+			m[ch.Id] = true
+		}
+		return m
+	}
+	before, after := ids(prev), ids(next)
+	for _, c := range next {
+		if !before[c.Id] {
+			added = append(added, c.Id)
+		}
+	}
+	for _, c := range prev {
+		if !after[c.Id] {
+			removed = append(removed, c.Id)
+		}
+	}
+	return added, removed
+}
+
+type prefetchMsg struct {
+	seq int
+}
+
+type volumeMsg struct {
+	volume float64
+}
+
+type muteMsg struct {
+	muted bool
+}
+
+type idleMsg struct {
+	idle bool
+}
+
+type surfMsg struct {
+	seq int
+}
+
+type pauseMsg struct {
+	paused bool
+}
+
+type togglePauseMsg struct{}
+
+type pauseExpiredMsg struct {
+	seq int
+}
+
+type resumeMsg struct{}
+
+type bufferingMsg struct {
+	buffering bool
+}
+
+type rebufferTimeoutMsg struct {
+	since time.Time
+}
+
+func waitForRebuffer(since time.Time) tea.Cmd {
+	return tea.Tick(rebufferTimeout, func(time.Time) tea.Msg {
+		return rebufferTimeoutMsg{since: since}
+	})
+}
+
+// genreHeader is a non-selectable row starting a genre section in the
+// grouped view.
+type genreHeader struct {
+	genre string
+}
+
+func (h genreHeader) FilterValue() string { return "" }
+
+// itemDelegate draws the channels, marking the one with id playing.
+type itemDelegate struct {
+	list.DefaultDelegate
+	playing string
+}
+
+// fittedItem is a channel with its title and description already cut to
+// the list width.
+type fittedItem struct {
+	channel
+	title, desc string
+}
+
+func (f fittedItem) Title() string       { return f.title }
+func (f fittedItem) Description() string { return f.desc }
+
+// fitWidth flattens s to a single line and truncates it to width terminal
+// cells, counting wide and combining runes by the space they actually take
+// so that non-ASCII channel names don't push the list out of alignment.
+func fitWidth(s string, width int) string {
+	s = strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.Truncate(s, width, "…")
+}
+
+func (d itemDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	width := m.Width() - d.Styles.NormalTitle.GetPaddingLeft() - d.Styles.NormalTitle.GetPaddingRight()
+	switch i := item.(type) {
+	case genreHeader:
+		fmt.Fprintf(w, "\n%s", sectionStyle.Render(fitWidth("── "+i.genre, width)))
+		return
+	case channel:
+		title := i.Title()
+		if d.playing != "" && i.Id == d.playing {
+			title = fmt.Sprintf("%s %s", playingGlyph, title)
+		}
+		item = fittedItem{channel: i, title: fitWidth(title, width), desc: fitWidth(i.Description(), width)}
+	}
+	d.DefaultDelegate.Render(w, m, index, item)
+}
+
+// markPlaying moves the playing mark to m.playing, whatever the items were
+// built from. Only then does the delegate change: the theme is set before
+// the interface starts, and the delegate reads the width as it draws.
+func (m *model) markPlaying() {
+	if m.markedPlaying == m.playing {
+		return
+	}
+	d := newItemDelegate()
+	d.playing = m.playing
+	m.list.SetDelegate(d)
+	m.markedPlaying = m.playing
+}
+
+func newItemDelegate() itemDelegate {
+	d := list.NewDefaultDelegate()
+	d.Styles.SelectedTitle = cursorStyle
+	d.Styles.SelectedDesc = cursorStyle
+	d.SetSpacing(0)
+	if liteItems {
+		d.ShowDescription = false
+		d.Styles.NormalTitle = lipgloss.NewStyle().PaddingLeft(2)
+	}
+
+	return itemDelegate{DefaultDelegate: d}
+}
+
+func channelsToItems(c []somafm.Channel, favorites []string) []list.Item {
+	items := make([]list.Item, len(c))
+	for i, ch := range c {
+		items[i] = channel{Channel: ch, IsFavorite: slices.Contains(favorites, ch.Id)}
+	}
+	return items
+}
+
+// visibleChannels returns the channels to list, in display order: search
+// results by relevance, the catalog (or the active preset's or category's
+// part of it) in the chosen sort order, or the favorites in the user's order.
+func (m *model) visibleChannels() []somafm.Channel {
+	if m.searchResults != nil {
+		return m.searchResults
+	}
+	if !m.favoritesView {
+		channels := m.config.Channels.Channels
+		if m.presetName != "" {
+			channels = slices.DeleteFunc(slices.Clone(channels), func(c somafm.Channel) bool {
+				return !slices.Contains(m.config.Presets[m.presetName], c.Id)
+			})
+		}
+		if m.category != "" {
+			categories := m.config.categories()
+			channels = slices.DeleteFunc(slices.Clone(channels), func(c somafm.Channel) bool {
+				return categories.Of(c) != m.category
+			})
+		}
+		return somafm.SortChannels(channels, m.config.SortMode, m.config.Favorites)
+	}
+	var c []somafm.Channel
+	for _, id := range m.config.Favorites {
+		if ch, ok := m.config.Channels.Find(id); ok {
+			c = append(c, *ch)
+		}
+	}
+	return c
+}
+
+func primaryGenre(c channel) string {
+	genre, _, _ := strings.Cut(c.Genre, "|")
+	genre = strings.TrimSpace(genre)
+	if genre == "" {
+		return "Other"
+	}
+	return strings.ToUpper(genre[:1]) + genre[1:]
+}
+
+// groupByGenre sorts the items by their first genre and starts each genre
+// with a header row.
+func groupByGenre(items []list.Item) []list.Item {
+	sorted := slices.Clone(items)
+	slices.SortStableFunc(sorted, func(a, b list.Item) int {
+		return strings.Compare(strings.ToLower(primaryGenre(a.(channel))), strings.ToLower(primaryGenre(b.(channel))))
+	})
+
+	var grouped []list.Item
+	current := ""
+	for _, item := range sorted {
+		if genre := primaryGenre(item.(channel)); !strings.EqualFold(genre, current) {
+			grouped = append(grouped, genreHeader{genre: genre})
+			current = genre
+		}
+		grouped = append(grouped, item)
+	}
+	return grouped
+}
+
+// nextCategory narrows the catalog to the next category with channels, and
+// back to every channel after the last one.
+func (m *model) nextCategory() {
+	categories := m.config.categories().List(m.config.Channels.Channels)
+	if i := slices.Index(categories, m.category); i+1 < len(categories) {
+		m.category = categories[i+1]
+	} else {
+		m.category = ""
+	}
+}
+
+// refreshItems rebuilds the list items, keeping the cursor on the same
+// channel if it is still listed, or at the same position otherwise.
+func (m *model) refreshItems() tea.Cmd {
+	selected := ""
+	if c, ok := m.selectedChannel(); ok {
+		selected = c.Id
+	}
+	index := m.list.Index()
+
+	items := channelsToItems(m.visibleChannels(), m.config.Favorites)
+	for i, item := range items {
+		c := item.(channel)
+		if song, ok := m.whatsOn[c.Id]; ok {
+			c.NowPlaying = song.String()
+		}
+		c.Note = m.config.Notes[c.Id]
+		items[i] = c
+	}
+	if m.config.GroupByGenre && !m.favoritesView && m.searchResults == nil {
+		items = groupByGenre(items)
+	}
+	cmd := m.list.SetItems(items)
+
+	if !m.selectChannel(selected) {
+		m.list.Select(min(index, max(len(items)-1, 0)))
+		m.skipHeaders(index)
+	}
+	m.refreshDetails()
+	return cmd
+}
+
+func (m *model) selectedChannel() (channel, bool) {
+	c, ok := m.list.SelectedItem().(channel)
+	return c, ok
+}
+
+// playingChannel returns the channel playing, or the one paused, which the
+// cursor may well have left.
+func (m *model) playingChannel() (*somafm.Channel, bool) {
+	id := m.playing
+	if id == "" {
+		id = m.config.CurrentlyPlaying
+	}
+	return m.player.Channel(id)
+}
+
+// selectChannel moves the cursor to the channel with the given id, if it is
+// listed.
+func (m *model) selectChannel(id string) bool {
+	for i, item := range m.list.VisibleItems() {
+		if c, ok := item.(channel); ok && c.Id == id {
+			m.list.Select(i)
+			m.refreshDetails()
+			return true
+		}
+	}
+	return false
+}
+
+// skipHeaders moves the cursor off a genre header, in the direction it was
+// moving from the previous index.
+func (m *model) skipHeaders(previous int) {
+	items := m.list.VisibleItems()
+	if len(items) == 0 {
+		return
+	}
+	if _, ok := m.list.SelectedItem().(genreHeader); !ok {
+		return
+	}
+	diff := m.list.Index() - previous
+	step := 1
+	if diff < 0 {
+		step = -1
+	}
+	if m.list.InfiniteScrolling && 2*max(diff, -diff) > len(items) {
+		// The cursor wrapped around the end of the list.
+		step = -step
+	}
+	for _, dir := range []int{step, -step} {
+		i := m.list.Index()
+		for range items {
+			i += dir
+			if m.list.InfiniteScrolling {
+				i = (i + len(items)) % len(items)
+			} else if i < 0 || i >= len(items) {
+				break
+			}
+			if _, ok := items[i].(channel); ok {
+				m.list.Select(i)
+				return
+			}
+		}
+	}
+}
+
+func (m *model) updateTitle() {
+	m.list.Title = "SomaFM"
+	if m.favoritesView {
+		m.list.Title = "SomaFM ★ Favorites"
+	} else if m.presetName != "" {
+		m.list.Title = fmt.Sprintf("SomaFM · %s", m.presetName)
+	}
+	if m.category != "" && !m.favoritesView {
+		m.list.Title = fmt.Sprintf("%s · %s", m.list.Title, m.category)
+	}
+	if m.searchResults != nil {
+		m.list.Title = fmt.Sprintf("%s — search: %s", m.list.Title, m.searchQuery)
+	}
+	m.list.Title += m.cacheInfo()
+	if m.config.ShowClock {
+		clock := time.Now().Format("15:04:05")
+		if m.lite {
+			clock = time.Now().Format("15:04")
+		}
+		if m.playing != "" && !m.trackStarted.IsZero() {
+			elapsed := time.Since(m.trackStarted).Truncate(time.Second)
+			if m.lite {
+				clock = fmt.Sprintf("%s · %dm", clock, int(elapsed.Minutes()))
+			} else {
+				clock = fmt.Sprintf("%s · %02d:%02d", clock, int(elapsed.Minutes()), int(elapsed.Seconds())%60)
+			}
+		}
+		m.list.Title = fmt.Sprintf("%s  %s", m.list.Title, clock)
+	}
+	if c, ok := m.player.Channel(m.queued); ok {
+		m.list.Title = fmt.Sprintf("%s  Next: %s", m.list.Title, c.ChannelTitle)
+	}
+	if m.onBattery && m.player.Quality() == somafm.QualitySlow {
+		m.list.Title = fmt.Sprintf("%s  🔋 %s", m.list.Title, somafm.QualitySlow)
+	}
+	if m.config.Diagnostics && m.playing != "" {
+		m.list.Title = fmt.Sprintf("%s  ⟳ %d", m.list.Title, m.player.Reconnects())
+		if f := m.player.Fallback(); f != nil {
+			m.list.Title = fmt.Sprintf("%s  ↓ %s", m.list.Title, f.Got)
+		}
+	}
+	if m.sampler != nil {
+		left := max(time.Until(m.sampleEnds).Round(time.Second), 0)
+		m.list.Title = fmt.Sprintf("%s — Sampling %d/%d — %02d:%02d left", m.list.Title,
+			m.sampleIndex+1, len(m.sampler), int(left.Minutes()), int(left.Seconds())%60)
+	}
+}
+
+// cacheInfo describes the cached channel list for the title, abbreviated
+// on narrow terminals.
+func (m *model) cacheInfo() string {
+	n := len(m.config.Channels.Channels)
+	age := formatAge(cacheClock().Sub(m.config.LastChannelsListUpdate))
+	if m.width > 0 && m.width < 80 {
+		return fmt.Sprintf(" (%d · %s)", n, age)
+	}
+	if age == "now" {
+		return fmt.Sprintf(" (%d channels, updated just now)", n)
+	}
+	return fmt.Sprintf(" (%d channels, updated %s ago)", n, age)
+}
+
+// formatAge rounds d to its largest unit, e.g. 3d or 5h.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// layout fits the list in the window, leaving room for the search or note
+// prompt and the details panel.
+func (m *model) layout() {
+	width, height := m.width-docStyle.GetHorizontalFrameSize(), m.height-docStyle.GetVerticalFrameSize()
+	if m.searching || m.editingNote != "" {
+		height--
+	}
+	if m.showDetails {
+		height = m.layoutDetails(width, height)
+	}
+	m.list.SetShowHelp(m.config.ShowHelp && m.height >= helpMinHeight)
+	m.list.SetSize(width, height)
+	// The list gives its help the whole width, and then indents it.
+	m.list.Help.Width = width - m.list.Styles.HelpStyle.GetHorizontalFrameSize()
+}
+
+func (m *model) startSearch() tea.Cmd {
+	m.searching = true
+	m.searchInput = textinput.New()
+	m.searchInput.Prompt = "Search: "
+	m.searchInput.SetValue(m.searchQuery)
+	m.layout()
+	return m.searchInput.Focus()
+}
+
+func (m *model) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.searching = false
+	case "enter":
+		m.searching = false
+		m.searchQuery = strings.TrimSpace(m.searchInput.Value())
+		m.searchResults = nil
+		if m.searchQuery != "" {
+			m.searchResults = somafm.Search(m.config.Channels.Channels, m.searchQuery)
+		}
+		m.updateTitle()
+		m.list.ResetFilter()
+		cmd := m.refreshItems()
+		m.list.Select(0)
+		m.layout()
+		return cmd
+	default:
+		var cmd tea.Cmd
+		m.searchInput, cmd = m.searchInput.Update(msg)
+		return cmd
+	}
+	m.layout()
+	return nil
+}
+
+// startNote opens the prompt editing the note of channel c.
+func (m *model) startNote(c channel) tea.Cmd {
+	m.editingNote = c.Id
+	m.noteInput = textinput.New()
+	m.noteInput.Prompt = fmt.Sprintf("Note for %s: ", c.ChannelTitle)
+	m.noteInput.SetValue(m.config.Notes[c.Id])
+	m.layout()
+	return m.noteInput.Focus()
+}
+
+// updateNote handles keys while a note is edited. An empty note removes it.
+func (m *model) updateNote(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.editingNote = ""
+	case "enter":
+		note := strings.TrimSpace(m.noteInput.Value())
+		if note == "" {
+			delete(m.config.Notes, m.editingNote)
+		} else {
+			if m.config.Notes == nil {
+				m.config.Notes = map[string]string{}
+			}
+			m.config.Notes[m.editingNote] = note
+		}
+		m.editingNote = ""
+		cmd := m.refreshItems()
+		m.layout()
+		return cmd
+	default:
+		var cmd tea.Cmd
+		m.noteInput, cmd = m.noteInput.Update(msg)
+		return cmd
+	}
+	m.layout()
+	return nil
+}
+
+func (m *model) pause() {
+	m.player.Pause()
+	m.config.IsPaused = true
+	m.playing = ""
+	m.list.NewStatusMessage("")
+}
+
+// resume resumes the last played channel, reloading it if mpv has moved on
+// to something else.
+func (m *model) resume() {
+	id := m.config.CurrentlyPlaying
+	if id == "" {
+		return
+	}
+	m.takeOver()
+	if m.player.Playing() == id {
+		m.player.Resume()
+	} else {
+		m.startStream(id)
+	}
+	m.playing = id
+	m.config.IsPaused = false
+}
+
+// surf moves the cursor to the next (or previous) listed channel, wrapping
+// around at the ends, and schedules playing it.
+func (m *model) surf(step int) tea.Cmd {
+	items := m.list.VisibleItems()
+	if len(items) == 0 {
+		return nil
+	}
+	i := m.list.Index()
+	for range items {
+		i = (i + step + len(items)) % len(items)
+		if _, ok := items[i].(channel); ok {
+			m.list.Select(i)
+			break
+		}
+	}
+
+	m.refreshDetails()
+	m.surfSeq++
+	seq := m.surfSeq
+	return tea.Tick(surfDelay, func(time.Time) tea.Msg {
+		return surfMsg{seq: seq}
+	})
+}
+
+// startSampler plays each listed channel in turn for SamplerSeconds,
+// starting from the selected one and looping until stopped.
+func (m *model) startSampler() tea.Cmd {
+	var channels []somafm.Channel
+	for _, item := range m.list.VisibleItems() {
+		if c, ok := item.(channel); ok {
+			channels = append(channels, c.Channel)
+		}
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+	m.sampler = channels
+	m.sampleIndex = 0
+	if c, ok := m.selectedChannel(); ok {
+		m.sampleIndex = max(slices.IndexFunc(channels, func(s somafm.Channel) bool { return s.Id == c.Id }), 0)
+	}
+	m.playSample()
+	m.sampleSeq++
+	return sampleTick(m.sampleSeq)
+}
+
+// rotateFavorites switches to the favorites and samples them, for a radio
+// of the user's own channels from the start.
+func (m *model) rotateFavorites() error {
+	if len(m.config.Favorites) == 0 {
+		return fmt.Errorf("no favorites to rotate through")
+	}
+	m.favoritesView = true
+	m.refreshItems()
+	m.startSampler()
+	return nil
+}
+
+func (m *model) playSample() {
+	c := m.sampler[m.sampleIndex]
+	m.selectChannel(c.Id)
+	m.PlaySelectedChannel()
+	m.config.IsPaused = false
+	m.sampleEnds = time.Now().Add(time.Duration(max(m.config.SamplerSeconds, 1)) * time.Second)
+	m.updateTitle()
+}
+
+// stopSampler leaves the sampled channel playing.
+func (m *model) stopSampler() {
+	if m.playing != "" {
+		m.config.addRecent(m.playing)
+	}
+	m.sampler = nil
+	m.sampleSeq++
+	m.updateTitle()
+}
+
+// applyPreset restricts the catalog to the channels of the named preset.
+// Channels the preset lists but SomaFM no longer has are ignored, and a
+// preset left with no channels at all doesn't apply.
+func (m *model) applyPreset(name string) error {
+	ids, ok := m.config.Presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %q", name)
+	}
+	if !slices.ContainsFunc(ids, func(id string) bool {
+		_, ok := m.config.Channels.Find(id)
+		return ok
+	}) {
+		return fmt.Errorf("none of the channels of preset %q exist", name)
+	}
+	m.presetName = name
+	m.updateTitle()
+	m.refreshItems()
+	return nil
+}
+
+// adjustCacheSecs changes mpv's cache-secs by delta seconds, never going
+// below one second.
+func (m *model) adjustCacheSecs(delta float64) {
+	current := m.config.CacheSecs
+	if current == 0 {
+		current, _ = m.player.Client().GetFloatProperty("cache-secs")
+	}
+	m.config.CacheSecs = max(current+delta, 1)
+	if err := m.player.Client().SetProperty("cache-secs", m.config.CacheSecs); err != nil {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Unable to set cache-secs: %s", err)))
+		return
+	}
+	m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Cache: %gs", m.config.CacheSecs)))
+}
+
+func (m *model) toggleFavorite(id string) {
+	if m.config.isFavorite(id) {
+		m.config.removeFavorite(id)
+	} else {
+		m.config.addFavorite(id)
+	}
+}
+
+// moveFavorite moves a favorite by offset positions in the favorites order.
+func (m *model) moveFavorite(id string, offset int) {
+	i := slices.Index(m.config.Favorites, id)
+	j := i + offset
+	if i < 0 || j < 0 || j >= len(m.config.Favorites) {
+		return
+	}
+	m.config.Favorites[i], m.config.Favorites[j] = m.config.Favorites[j], m.config.Favorites[i]
+}
+
+// newModel sets up the interface on the channels in config, without talking
+// to mpv.
+func newModel(ctx context.Context, p *somafm.Player, config *somaConfig) model {
+	model := model{
+		playing:     "",
+		player:      p,
+		quitting:    false,
+		config:      config,
+		keepPlaying: config.KeepPlayingOnExit,
+		ctx:         ctx,
+		quietIndex:  -1,
+	}
+	// The keymap was checked when loading the config.
+	model.keys, _ = newKeymap(config.Keys)
+
+	p.SetChannels(model.config.Channels.Channels)
+	p.SetQuality(model.config.PreferredQuality)
+	p.SetQualityOverrides(model.config.qualityOverrides())
+
+	model.list = list.New(nil, newItemDelegate(), 0, 0)
+	model.list.Title = "SomaFM"
+	model.list.SetShowPagination(model.config.ShowPagination)
+	model.list.SetShowStatusBar(model.config.ShowStatusBar)
+	model.list.SetShowHelp(model.config.ShowHelp)
+	setupHelp(&model.list, model.keys)
+	model.list.InfiniteScrolling = model.config.WrapNavigation
+	model.refreshItems()
+	model.clockTicking = model.config.ShowClock
+	model.updateTitle()
+
+	// Selection is restored by channel id, the saved order may not match the
+	// current sort or grouping.
+	model.selectChannel(model.config.Selected)
+	return model
+}
+
+// initialModel fetches the channels unless the cached ones do, and picks up
+// where mpv, or the last session, left off.
+func initialModel(ctx context.Context, p *somafm.Player, config *somaConfig) (model, error) {
+	refreshing := false
+	if config.BackgroundRefresh && len(config.Channels.Channels) != 0 {
+		// Start on the cached list, Init fetches the new one.
+		refreshing = config.channelsStale()
+	} else if err := config.refreshChannels(ctx); err != nil {
+		return model{}, fmt.Errorf("unable to fetch SomaFM stations: %w", err)
+	}
+	model := newModel(ctx, p, config)
+	model.refreshing = refreshing
+
+	mpvCurrentlyPlayingPath, err := p.GetString("path")
+	if err != nil {
+		return model, fmt.Errorf("unable to ask mpv what it is playing: %w", err)
+	}
+	if mpvCurrentlyPlayingPath != "" {
+		nowPlaying, _, _ := p.NowPlaying()
+		if nowPlaying != nil {
+			model.selectChannel(nowPlaying.Id)
+			p.Client().SetPause(model.config.IsPaused)
+			if !model.config.IsPaused {
+				model.playing = nowPlaying.Id
+			}
+		} else if p.Started() {
+			p.Pause()
+		} else {
+			// mpv was already playing something else: leave it alone
+			// until a channel is picked.
+			model.attached = true
+			model.list.NewStatusMessage(statusMessageStyle("Attached to mpv, which is playing something else. Pick a channel to take over."))
+		}
+	} else {
+		if model.config.CurrentlyPlaying != "" {
+			for _, c := range model.config.Channels.Channels {
+				if c.Id == model.config.CurrentlyPlaying {
+					model.selectChannel(c.Id)
+					if !model.config.IsPaused && model.config.AutoPlay {
+						model.playing = c.Id
+						model.startStream(c.Id)
+					}
+					break
+				}
+			}
+		}
+	}
+
+	if !model.attached {
+		model.applySettings()
+	}
+	model.markPlaying()
+	return model, nil
+}
+
+// applySettings applies the saved mpv settings. A saved audio device that
+// isn't plugged in is left for next time.
+func (m *model) applySettings() {
+	if m.config.CacheSecs > 0 {
+		m.player.Client().SetProperty("cache-secs", m.config.CacheSecs)
+	}
+	if m.config.AudioDevice != "" {
+		devices, _ := m.player.AudioDevices()
+		if slices.ContainsFunc(devices, func(d somafm.AudioDevice) bool { return d.Name == m.config.AudioDevice }) {
+			m.player.SetAudioDevice(m.config.AudioDevice)
+		}
+	}
+}
+
+// cycleAudioDevice switches to the next audio output. The device list is
+// read again each time, as devices come and go.
+func (m *model) cycleAudioDevice() {
+	devices, err := m.player.AudioDevices()
+	if err != nil || len(devices) == 0 {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Unable to list audio devices: %v", err)))
+		return
+	}
+	current, _ := m.player.AudioDevice()
+	i := slices.IndexFunc(devices, func(d somafm.AudioDevice) bool { return d.Name == current })
+	next := devices[(i+1)%len(devices)]
+	if err := m.player.SetAudioDevice(next.Name); err != nil {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Unable to switch to %s: %s", next.Description, err)))
+		return
+	}
+	m.config.AudioDevice = next.Name
+	m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Audio: %s", next.Description)))
+}
+
+// takeOver ends the read-only attach mode once the user plays a channel.
+func (m *model) takeOver() {
+	if m.attached {
+		m.attached = false
+		m.applySettings()
+	}
+}
+
+func (m model) Init() tea.Cmd {
+	var cmds []tea.Cmd
+	if m.config.ShowClock {
+		cmds = append(cmds, m.clockTick())
+	}
+	if len(m.config.QuietHours) > 0 {
+		cmds = append(cmds, func() tea.Msg { return quietTickMsg{} })
+	}
+	if m.config.SlowOnBattery {
+		cmds = append(cmds, func() tea.Msg { return powerTickMsg{} })
+	}
+	if m.refreshing {
+		cmds = append(cmds, fetchChannels(m.ctx, true))
+	}
+	if m.sampler != nil {
+		cmds = append(cmds, sampleTick(m.sampleSeq))
+	}
+	if m.streamWanted != "" {
+		cmds = append(cmds, func() tea.Msg { return streamWantedMsg{} })
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m *model) PlaySelectedChannel() {
+	c, ok := m.selectedChannel()
+	if !ok {
+		return
+	}
+	m.queued = ""
+	m.takeOver()
+	m.playing = c.Id
+	if saved, ok := m.player.Prefetched(c.Id); ok && saved >= 100*time.Millisecond {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("♫ Buffering… (stream prefetched, %.1fs saved)", saved.Seconds())))
+	}
+	m.startStream(m.playing)
+	m.config.CurrentlyPlaying = c.Id
+	if m.sampler == nil {
+		m.config.addRecent(c.Id)
+	}
+	m.updateTitle()
+}
+
+// volumeStep is how much + and - change the volume.
+const volumeStep = 5
+
+// adjustVolume turns mpv's volume up or down, unmuting it on the way up.
+func (m *model) adjustVolume(up bool) {
+	client := m.player.Client()
+	v, err := client.GetFloatProperty("volume")
+	if err != nil {
+		return
+	}
+	if up {
+		v = min(v+volumeStep, 100)
+		client.SetProperty("mute", false)
+	} else {
+		v = max(v-volumeStep, 0)
+	}
+	client.SetProperty("volume", v)
+	m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Volume: %.0f%%", v)))
+}
+
+// hintIfSilent tells how to get sound when a channel plays with mpv muted
+// or at volume 0, the first time only.
+func (m *model) hintIfSilent() {
+	if m.volumeHinted || m.playing == "" || !m.volumeKnown {
+		return
+	}
+	switch {
+	case m.muted:
+		m.list.NewStatusMessage(statusMessageStyle("mpv is muted: press + to unmute"))
+	case m.volume == 0:
+		m.list.NewStatusMessage(statusMessageStyle("Volume is 0: press + to turn it up"))
+	default:
+		return
+	}
+	m.volumeHinted = true
+}
+
+// startStream asks for the stream of channel id to be loaded in mpv. Picking
+// it may probe unreachable URLs for seconds, so Update does it in the
+// background with pickStream and loads it once streamPickedMsg is back.
+func (m *model) startStream(id string) {
+	m.stoppedPaused = false
+	m.streamSeq++
+	m.streamWanted = id
+}
+
+// streamPickedMsg carries the stream picked for the startStream request seq.
+type streamPickedMsg struct {
+	seq    int
+	id     string
+	stream somafm.Stream
+	err    error
+}
+
+// streamWantedMsg gets a stream asked for before the program started
+// through Update, which picks it.
+type streamWantedMsg struct{}
+
+// pickStream picks the stream startStream asked for.
+func (m *model) pickStream() tea.Cmd {
+	id := m.streamWanted
+	m.streamWanted = ""
+	c, ok := m.player.Channel(id)
+	if !ok {
+		return nil
+	}
+	ctx, player, channel, quality, seq := m.ctx, m.player, *c, m.player.QualityFor(*c), m.streamSeq
+	return func() tea.Msg {
+		s, err := player.PickStream(ctx, channel, quality)
+		return streamPickedMsg{seq: seq, id: id, stream: s, err: err}
+	}
+}
+
+// playStream loads the picked stream, unless another was asked for or
+// playback stopped meanwhile, and reports it when it had to fall back on
+// another stream than the preferred one.
+func (m *model) playStream(msg streamPickedMsg) {
+	if msg.seq != m.streamSeq || msg.id != m.playing {
+		return
+	}
+	err := msg.err
+	if err == nil {
+		err = m.player.PlayStream(msg.stream)
+	}
+	if err != nil {
+		logger.Error("playing", "channel", msg.id, "error", err)
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("⚠ Unable to play %s: %s", msg.id, err)))
+		return
+	}
+	m.hintIfSilent()
+	m.updateTitle()
+	f := msg.stream.Fallback
+	if f == nil {
+		return
+	}
+	m.recordEvent(historyEntry{Channel: msg.id, Event: "fallback", Wanted: f.Wanted, Got: f.Got, Tried: f.Tried, URL: f.URL})
+	if f.Got == f.Wanted {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("⚠ Preferred %s stream unreachable, playing another one", f.Wanted)))
+	} else {
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("⚠ No %s stream answered, playing %s", f.Wanted, f.Got)))
+	}
+}
+
+// playChannel plays the channel with the given id, moving the cursor to it
+// if it is listed.
+func (m *model) playChannel(id string) {
+	m.queued = ""
+	if m.sampler != nil {
+		m.stopSampler()
+	}
+	m.takeOver()
+	m.selectChannel(id)
+	m.playing = id
+	m.startStream(id)
+	m.config.CurrentlyPlaying = id
+	m.config.addRecent(id)
+	m.config.IsPaused = false
+	m.updateTitle()
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	updated, cmd := m.update(msg)
+	m, ok := updated.(model)
+	if !ok {
+		return updated, cmd
+	}
+	if m.streamWanted != "" {
+		cmd = tea.Batch(cmd, m.pickStream())
+	}
+	m.markPlaying()
+	if fetch := m.fetchArtwork(); fetch != nil {
+		cmd = tea.Batch(cmd, fetch)
+	}
+	state := m.mprisState()
+	m.mpris.update(state)
+	m.web.update(state, m.config.Channels.Channels)
+	return m, cmd
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case streamPickedMsg:
+		m.playStream(msg)
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.updateTitle()
+		m.layout()
+	case clockTickMsg:
+		if !m.config.ShowClock {
+			m.clockTicking = false
+			break
+		}
+		m.updateTitle()
+		return m, m.clockTick()
+	case currentTitleUpdateMsg:
+		if m.attached {
+			break
+		}
+		if m.config.TitleDebounceMs <= 0 {
+			cmd := m.applyTitle(msg.title)
+			return m, cmd
+		}
+		m.titleSeq++
+		seq := m.titleSeq
+		return m, tea.Tick(time.Duration(m.config.TitleDebounceMs)*time.Millisecond, func(time.Time) tea.Msg {
+			return titleSettledMsg{seq: seq, title: msg.title}
+		})
+	case titleSettledMsg:
+		if msg.seq == m.titleSeq {
+			cmd := m.applyTitle(msg.title)
+			return m, cmd
+		}
+	case flashDoneMsg:
+		m.list.Styles.Title = titleStyle
+	case metadataMsg:
+		if m.attached {
+			break
+		}
+		m.streamInfo = msg.info
+		if m.title != "" {
+			m.showNowPlaying()
+		}
+	case sampleTickMsg:
+		if msg.seq != m.sampleSeq || m.sampler == nil {
+			break
+		}
+		if !time.Now().Before(m.sampleEnds) {
+			m.sampleIndex = (m.sampleIndex + 1) % len(m.sampler)
+			m.playSample()
+		}
+		m.updateTitle()
+		return m, sampleTick(msg.seq)
+	case whatsOnMsg:
+		m.fetchingOn = false
+		m.whatsOn = msg.songs
+		m.whatsOnFetched = time.Now()
+		cmd := m.refreshItems()
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("What's on: %d channels", len(msg.songs))))
+		return m, cmd
+	case channelsMsg:
+		m.refreshing = false
+		if msg.err != nil {
+			logger.Warn("fetching channels", "background", msg.background, "error", msg.err)
+			m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Unable to fetch Somafm stations: %s", msg.err)))
+			break
+		}
+		added, removed := diffChannels(m.config.Channels.Channels, msg.channels.Channels)
+		m.config.Channels = *msg.channels
+		m.config.LastChannelsListUpdate = cacheClock()
+		m.player.SetChannels(m.config.Channels.Channels)
+		m.updateTitle()
+		cmd := m.refreshItems()
+		if !msg.background {
+			m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Fetched %d channels", len(m.config.Channels.Channels))))
+		} else if len(added) > 0 || len(removed) > 0 {
+			m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("List updated: %d new, %d gone", len(added), len(removed))))
+		}
+		return m, cmd
+	case volumeMsg:
+		m.volume, m.volumeKnown = msg.volume, true
+		m.hintIfSilent()
+	case muteMsg:
+		m.muted = msg.muted
+		m.hintIfSilent()
+	case idleMsg:
+		// mpv only goes idle once something it played has ended; a channel
+		// switch replaces the stream without going through idle.
+		if !msg.idle {
+			m.streamStarted = true
+			break
+		}
+		if m.untilEnd && m.streamStarted && !m.attached {
+			cmd := m.quit()
+			return m, cmd
+		}
+	case powerTickMsg:
+		m.checkPower()
+		return m, powerTick()
+	case quietTickMsg:
+		m.applyQuietHours(time.Now())
+		return m, quietTick()
+	case prefetchMsg:
+		c, ok := m.selectedChannel()
+		if msg.seq != m.prefetchSeq || !ok || c.Id == m.playing {
+			break
+		}
+		ctx, cancel := context.WithCancel(m.ctx)
+		m.prefetchCancel = cancel
+		player, quality := m.player, m.player.QualityFor(c.Channel)
+		return m, func() tea.Msg {
+			player.Prefetch(ctx, c.Channel, quality)
+			return nil
+		}
+	case surfMsg:
+		if msg.seq != m.surfSeq {
+			break
+		}
+		if m.sampler != nil {
+			m.stopSampler()
+		}
+		if c, ok := m.selectedChannel(); ok && c.Id != m.playing {
+			m.PlaySelectedChannel()
+			m.config.IsPaused = false
+		}
+	case mpvExitedMsg:
+		m.mpvExited = true
+		m.mpvExitErr = msg.err
+		m.saveErr = m.config.saveConfig()
+		m.quitting = true
+		return m, tea.Quit
+	case togglePauseMsg:
+		m.togglePause()
+	case mprisMsg:
+		cmd := m.handleMPRIS(msg)
+		return m, cmd
+	case artworkMsg:
+		if msg.url != m.artworkURL {
+			break
+		}
+		if msg.err != nil {
+			// Clients fall back to the image's URL.
+			logger.Warn("fetching artwork", "url", msg.url, "error", msg.err)
+			break
+		}
+		m.artworkPath = msg.path
+	case webPlayMsg:
+		if _, ok := m.player.Channel(msg.id); ok {
+			m.playChannel(msg.id)
+		}
+	case resumeMsg:
+		if m.playing == "" {
+			m.resume()
+		}
+	case bufferingMsg:
+		m.cacheStalled = msg.buffering
+		if !msg.buffering {
+			m.bufferingSince = time.Time{}
+			break
+		}
+		if m.playing == "" && !m.config.IsPaused && !m.attached {
+			// core-idle came first and was taken for a pause.
+			m.playing = m.config.CurrentlyPlaying
+		}
+		if m.playing == "" {
+			break
+		}
+		m.bufferingSince = time.Now()
+		m.list.NewStatusMessage(statusMessageStyle("♫ Buffering…"))
+		return m, waitForRebuffer(m.bufferingSince)
+	case rebufferTimeoutMsg:
+		if m.bufferingSince.IsZero() || !m.bufferingSince.Equal(msg.since) || m.playing == "" {
+			break
+		}
+		m.player.Reload()
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("♫ Stream stalled, reconnecting (attempt %d)…", m.player.Reconnects())))
+		m.updateTitle()
+		m.bufferingSince = time.Now()
+		return m, waitForRebuffer(m.bufferingSince)
+	case pauseMsg:
+		// mpv's pause property is the source of truth for the saved state,
+		// whoever paused it.
+		if !m.attached {
+			m.config.IsPaused = msg.paused
+		}
+		if !msg.paused && m.stoppedPaused {
+			// Unpaused from elsewhere, e.g. --toggle-pause: there is
+			// nothing loaded to resume.
+			m.resume()
+		}
+		cmd := m.schedulePauseStop(msg.paused)
+		return m, cmd
+	case pauseExpiredMsg:
+		if msg.seq == m.pauseSeq {
+			m.stopPaused()
+		}
+	case changePausedStatusMsg:
+		if m.attached {
+			break
+		}
+		if msg.paused {
+			// core-idle is also set while mpv waits for its cache to fill;
+			// that is not a pause from the user's point of view.
+			if m.cacheStalled {
+				break
+			}
+		}
+		if msg.paused {
+			m.playing = ""
+			m.list.NewStatusMessage("")
+		} else {
+			m.playing = m.config.CurrentlyPlaying
+			m.title, _ = m.player.GetString("media-title")
+			m.showNowPlaying()
+		}
+	case tea.KeyMsg:
+		if m.searching && msg.String() != "ctrl+c" {
+			cmd := m.updateSearch(msg)
+			return m, cmd
+		}
+		if m.editingNote != "" && msg.String() != "ctrl+c" {
+			cmd := m.updateNote(msg)
+			return m, cmd
+		}
+		if m.switching && msg.String() != "ctrl+c" {
+			m.updateSwitcher(msg)
+			return m, nil
+		}
+		if m.showingLog && msg.String() != "ctrl+c" {
+			m.showingLog = false
+			return m, nil
+		}
+		// Keys are only rebound while browsing, the filter takes them as typed.
+		key := msg.String()
+		if m.list.FilterState() != list.Filtering {
+			key = m.keys.translate(key)
+		}
+		switch key {
+
+		case "ctrl+c", "q":
+			cmd := m.quit()
+			return m, cmd
+
+		case "P":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.config.ShowPagination = !m.config.ShowPagination
+			m.list.SetShowPagination(m.config.ShowPagination)
+			return m, nil
+
+		case "S":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.config.ShowStatusBar = !m.config.ShowStatusBar
+			m.list.SetShowStatusBar(m.config.ShowStatusBar)
+			return m, nil
+
+		case "H":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.config.ShowHelp = !m.config.ShowHelp
+			m.layout()
+			return m, nil
+
+		case "1", "2", "3":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			quality := []somafm.Quality{somafm.QualityHighest, somafm.QualityFast, somafm.QualitySlow}[key[0]-'1']
+			m.config.PreferredQuality = quality
+			m.player.SetQuality(quality)
+			if m.playing != "" {
+				m.startStream(m.playing)
+			}
+			if m.onBattery {
+				// Until the power source changes, see checkPower.
+				m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Quality: %s, battery saver off until unplugged again", quality)))
+			} else {
+				m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Quality: %s", quality)))
+			}
+			m.updateTitle()
+			return m, nil
+
+		case "f":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			// f also pages the list forward, which a genre header shouldn't
+			// fall through to.
+			c, ok := m.selectedChannel()
+			if !ok {
+				return m, nil
+			}
+			m.toggleFavorite(c.Id)
+			cmd := m.refreshItems()
+			return m, cmd
+
+		case "F":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.favoritesView = !m.favoritesView
+			m.updateTitle()
+			m.list.ResetFilter()
+			cmd := m.refreshItems()
+			return m, cmd
+
+		case "K", "J":
+			c, ok := m.selectedChannel()
+			if !m.favoritesView || m.list.FilterState() != list.Unfiltered || !ok {
+				break
+			}
+			offset := 1
+			if key == "K" {
+				offset = -1
+			}
+			m.moveFavorite(c.Id, offset)
+			cmd := m.refreshItems()
+			return m, cmd
+
+		case "n", "p":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			step := 1
+			if key == "p" {
+				step = -1
+			}
+			cmd := m.surf(step)
+			return m, cmd
+
+		case "o":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			// o cycles through the single modes; a combination set in the
+			// config goes back to the start of the cycle.
+			i := -1
+			if len(m.config.SortMode) == 0 {
+				i = 0
+			} else if len(m.config.SortMode) == 1 {
+				i = slices.Index(somafm.SortModes, m.config.SortMode[0])
+			}
+			m.config.SortMode = nil
+			if next := somafm.SortModes[(i+1)%len(somafm.SortModes)]; next != somafm.SortDefault {
+				m.config.SortMode = somafm.SortOrder{next}
+			}
+			cmd := m.refreshItems()
+			m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Sort: %s", m.config.SortMode)))
+			return m, cmd
+
+		case "[", "]":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			delta := 5.0
+			if key == "[" {
+				delta = -5
+			}
+			m.adjustCacheSecs(delta)
+			return m, nil
+
+		case "t":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.config.ShowClock = !m.config.ShowClock
+			m.updateTitle()
+			if m.config.ShowClock && !m.clockTicking {
+				m.clockTicking = true
+				return m, m.clockTick()
+			}
+			return m, nil
+
+		case "v":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.config.GroupByGenre = !m.config.GroupByGenre
+			cmd := m.refreshItems()
+			return m, cmd
+
+		case "c":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.nextCategory()
+			m.updateTitle()
+			cmd := m.refreshItems()
+			return m, cmd
+
+		case "s":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			cmd := m.startSearch()
+			return m, cmd
+
+		case "w":
+			if m.list.FilterState() == list.Filtering || m.fetchingOn {
+				break
+			}
+			if time.Since(m.whatsOnFetched) < whatsOnTTL {
+				m.list.NewStatusMessage(statusMessageStyle("What's on: up to date"))
+				return m, nil
+			}
+			m.fetchingOn = true
+			m.list.NewStatusMessage(statusMessageStyle("What's on: fetching…"))
+			return m, fetchWhatsOn(m.ctx, m.config.Channels.Channels)
+
+		case " ":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.togglePause()
+			return m, nil
+
+		case "+", "-":
+			if m.list.FilterState() == list.Filtering || m.attached {
+				break
+			}
+			m.adjustVolume(key == "+")
+			return m, nil
+
+		case "u":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			// u also pages the list back, which nothing to queue shouldn't
+			// fall through to.
+			if c, ok := m.selectedChannel(); ok && !m.attached {
+				m.toggleQueued(c)
+			}
+			return m, nil
+
+		case "i":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.showDetails = !m.showDetails
+			m.detailsID = ""
+			m.layout()
+			m.refreshDetails()
+			return m, nil
+
+		case "{", "}":
+			if m.list.FilterState() == list.Filtering || !m.showDetails {
+				break
+			}
+			if key == "{" {
+				m.details.LineUp(3)
+			} else {
+				m.details.LineDown(3)
+			}
+			return m, nil
+
+		case "N":
+			c, ok := m.selectedChannel()
+			if m.list.FilterState() == list.Filtering || !ok {
+				break
+			}
+			cmd := m.startNote(c)
+			return m, cmd
+
+		case "R":
+			if m.list.FilterState() == list.Filtering || m.refreshing {
+				break
+			}
+			m.refreshing = true
+			m.list.NewStatusMessage(statusMessageStyle("Fetching channels…"))
+			return m, fetchChannels(m.ctx, false)
+
+		case "O":
+			c, ok := m.selectedChannel()
+			if m.list.FilterState() == list.Filtering || !ok {
+				break
+			}
+			if err := openBrowser(c.PageURL()); err != nil {
+				m.list.NewStatusMessage(statusMessageStyle(err.Error()))
+			} else {
+				m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Opened %s", c.PageURL())))
+			}
+			return m, nil
+
+		case "a":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.cycleAudioDevice()
+			return m, nil
+
+		case "L":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.showingLog = true
+			return m, nil
+
+		case "tab":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.switching = true
+			m.switchRecent = false
+			return m, nil
+
+		case "r":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.switching = true
+			m.switchRecent = true
+			return m, nil
+
+		case "e":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			if m.sampler != nil {
+				m.stopSampler()
+				return m, nil
+			}
+			cmd := m.startSampler()
+			return m, cmd
+
+		case "esc":
+			if m.sampler != nil && m.list.FilterState() == list.Unfiltered {
+				m.stopSampler()
+				return m, nil
+			}
+			if (m.searchResults == nil && m.presetName == "" && m.category == "") || m.list.FilterState() != list.Unfiltered {
+				break
+			}
+			if m.searchResults != nil {
+				m.searchResults = nil
+				m.searchQuery = ""
+			} else if m.category != "" {
+				m.category = ""
+			} else {
+				m.presetName = ""
+			}
+			m.updateTitle()
+			cmd := m.refreshItems()
+			return m, cmd
+
+		case "enter":
+			if m.list.FilterState() == list.Filtering {
+				return m, nil
+			}
+			m.activateSelected()
+			return m, nil
+		}
+	case tea.MouseMsg:
+		if m.searching || m.editingNote != "" || m.switching || m.showingLog || m.list.FilterState() == list.Filtering {
+			break
+		}
+		m.handleMouse(msg)
+		return m, nil
+	}
+	var cmd tea.Cmd
+	index := m.list.Index()
+	m.list, cmd = m.list.Update(msg)
+	m.skipHeaders(index)
+	m.refreshDetails()
+	return m, tea.Batch(cmd, m.schedulePrefetch())
+}
+
+// schedulePrefetch prefetches the selected channel's stream once the cursor
+// rests on it, abandoning the prefetch of the channel it left.
+func (m *model) schedulePrefetch() tea.Cmd {
+	c, ok := m.selectedChannel()
+	if !m.config.Prefetch || !ok || c.Id == m.prefetchID {
+		return nil
+	}
+	if m.prefetchCancel != nil {
+		m.prefetchCancel()
+		m.prefetchCancel = nil
+	}
+	m.prefetchID = c.Id
+	m.prefetchSeq++
+	seq := m.prefetchSeq
+	return tea.Tick(prefetchDelay, func(time.Time) tea.Msg {
+		return prefetchMsg{seq: seq}
+	})
+}
+
+// quit saves the state and stops mpv, or leaves it running when detaching.
+func (m *model) quit() tea.Cmd {
+	if c, ok := m.selectedChannel(); ok {
+		m.config.Selected = c.Id
+	}
+	if paused, err := m.player.Client().Pause(); err == nil && !m.attached {
+		m.config.IsPaused = paused
+	}
+	m.saveErr = m.config.saveConfig()
+	m.quitting = true
+	if m.keepPlaying || m.attached {
+		m.player.Detach()
+	} else {
+		m.player.Close()
+	}
+	return tea.Quit
+}
+
+// activateSelected plays the selected channel, or pauses it if it is the
+// one playing.
+func (m *model) activateSelected() {
+	c, ok := m.selectedChannel()
+	if !ok {
+		return
+	}
+	if m.sampler != nil && m.playing == c.Id {
+		// Lock onto the channel being sampled.
+		m.stopSampler()
+		return
+	}
+	if m.sampler != nil {
+		m.stopSampler()
+	}
+	if m.playing != c.Id || m.config.EnterAction == enterPlay {
+		m.PlaySelectedChannel()
+		m.config.IsPaused = false
+	} else {
+		m.pause()
+	}
+}
+
+// schedulePauseStop starts counting down to stopPaused when mpv pauses, and
+// cancels the countdown when it resumes.
+func (m *model) schedulePauseStop(paused bool) tea.Cmd {
+	m.pauseSeq++
+	if !paused || m.attached || m.config.StopAfterPauseMinutes == 0 {
+		return nil
+	}
+	m.pausedAt = time.Now()
+	seq := m.pauseSeq
+	return tea.Tick(time.Duration(m.config.StopAfterPauseMinutes)*time.Minute, func(time.Time) tea.Msg {
+		return pauseExpiredMsg{seq: seq}
+	})
+}
+
+// stopPaused unloads a stream paused for stopAfterPauseMinutes, so that it
+// doesn't sit on a stale connection and resuming loads it afresh.
+func (m *model) stopPaused() {
+	if m.player.Playing() == "" {
+		return
+	}
+	// mpv goes idle once stopped, which isn't the stream ending.
+	m.streamStarted = false
+	if err := m.player.Stop(); err != nil {
+		logger.Warn("stopping paused stream", "error", err)
+		return
+	}
+	m.stoppedPaused = true
+	logger.Info("stopped paused stream", "paused_for", time.Since(m.pausedAt).Round(time.Second))
+	m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Stopped after %d minutes paused", m.config.StopAfterPauseMinutes)))
+}
+
+// toggleQueued marks c to be played once the track playing ends, or unmarks
+// it. Playing another channel in the meantime forgets it.
+func (m *model) toggleQueued(c channel) {
+	switch {
+	case m.queued == c.Id:
+		m.queued = ""
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("%s unqueued", c.ChannelTitle)))
+	case m.playing == "":
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Nothing is playing: enter plays %s now", c.ChannelTitle)))
+	case m.playing == c.Id:
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("%s is already playing", c.ChannelTitle)))
+	default:
+		m.queued = c.Id
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Next: %s, after this track", c.ChannelTitle)))
+	}
+	m.updateTitle()
+}
+
+// togglePause pauses or resumes whatever is playing, wherever the cursor is.
+func (m *model) togglePause() {
+	if m.playing != "" {
+		m.pause()
+	} else {
+		m.resume()
+	}
+}
+
+// handleMouse scrolls the list with the wheel, selects the clicked channel,
+// and plays or pauses it when it was already selected.
+func (m *model) handleMouse(msg tea.MouseMsg) {
+	if msg.Action != tea.MouseActionPress {
+		return
+	}
+	index := m.list.Index()
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		m.list.CursorUp()
+		m.skipHeaders(index)
+		return
+	case tea.MouseButtonWheelDown:
+		m.list.CursorDown()
+		m.skipHeaders(index)
+		return
+	case tea.MouseButtonLeft:
+	default:
+		return
+	}
+
+	// Work out which row of the page was clicked from the height of what
+	// the list draws above its items.
+	top := docStyle.GetMarginTop() + docStyle.GetPaddingTop()
+	row := msg.Y - top - lipgloss.Height(m.list.Styles.TitleBar.Render(m.list.Title))
+	if m.list.ShowStatusBar() {
+		row -= lipgloss.Height(m.list.Styles.StatusBar.Render(""))
+	}
+	if row < 0 {
+		return
+	}
+	d := newItemDelegate()
+	items := m.list.VisibleItems()
+	start, end := m.list.Paginator.GetSliceBounds(len(items))
+	i := start + row/(d.Height()+d.Spacing())
+	if i >= end {
+		return
+	}
+	if _, ok := items[i].(channel); !ok {
+		return
+	}
+	if i == index {
+		m.activateSelected()
+		return
+	}
+	m.list.Select(i)
+}
+
+// applyTitle shows a new track title. The track change hook and the history
+// only see titles that actually changed, so that streams re-sending the same
+// metadata don't spam them.
+func (m *model) applyTitle(title string) tea.Cmd {
+	if c, ok := m.player.Channel(m.queued); ok && m.title != "" && title != m.title {
+		// The track changed: time for the queued channel. Its own title
+		// will follow.
+		m.playChannel(c.Id)
+		m.title = ""
+		m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("♫ On to %s", c.ChannelTitle)))
+		return nil
+	}
+	var cmd tea.Cmd
+	if title != m.title {
+		m.trackStarted = time.Now()
+		if c, ok := m.player.Channel(m.playing); ok {
+			runHook(m.config.OnTrackChange, c, title)
+			m.recordHistory(c.Id, title)
+			cmd = m.checkWatches(c, title)
+		}
+	}
+	m.title = title
+	if cmd == nil {
+		m.showNowPlaying()
+	}
+	return cmd
+}
+
+// checkWatches flashes the title bar and runs the OnWatch hook when the
+// track matches one of the watched artists or keywords.
+func (m *model) checkWatches(c *somafm.Channel, title string) tea.Cmd {
+	lower := strings.ToLower(title)
+	i := slices.IndexFunc(m.config.Watches, func(w string) bool {
+		return w != "" && strings.Contains(lower, strings.ToLower(w))
+	})
+	if i < 0 {
+		return nil
+	}
+	runHook(m.config.OnWatch, c, title)
+	m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("★ %s is on %s: %s", m.config.Watches[i], c.ChannelTitle, title)))
+	m.list.Styles.Title = titleStyle.Reverse(true)
+	return tea.Tick(watchFlashDuration, func(time.Time) tea.Msg {
+		return flashDoneMsg{}
+	})
+}
+
+// recordHistory appends the track to history.jsonl.
+func (m *model) recordHistory(channel, title string) {
+	if title == "" {
+		return
+	}
+	m.recordEvent(historyEntry{Channel: channel, Title: title})
+}
+
+// recordEvent appends e to history.jsonl, dated now.
+func (m *model) recordEvent(e historyEntry) {
+	path, err := historyPath()
+	if err != nil {
+		return
+	}
+	e.Time = time.Now()
+	if err := appendJSONLine(path, e); err != nil {
+		logger.Warn("writing history", "path", path, "error", err)
+	}
+}
+
+// showNowPlaying puts the playing channel and track in the status bar,
+// wherever the cursor is.
+func (m *model) showNowPlaying() {
+	c, ok := m.playingChannel()
+	if !ok {
+		return
+	}
+	volume := ""
+	if strings.Contains(m.config.StatusFormat, "{volume}") {
+		if v, err := m.player.Client().GetFloatProperty("volume"); err == nil {
+			volume = fmt.Sprintf("%.0f%%", v)
+		}
+	}
+	m.list.NewStatusMessage(statusMessageStyle(formatNowPlaying(m.config.StatusFormat, c, m.title, m.player.QualityFor(*c), volume, m.streamInfo)))
+}
+
+// formatNowPlaying builds the now playing line from format, see
+// statusFormat, or the default one if format is empty.
+func formatNowPlaying(format string, c *somafm.Channel, title string, quality somafm.Quality, volume string, info somafm.StreamInfo) string {
+	status := fmt.Sprintf("♫ Now playing: « %s | %s »", c.ChannelTitle, title)
+	if format != "" {
+		status = strings.NewReplacer(
+			"{channel}", c.ChannelTitle,
+			"{id}", c.Id,
+			"{title}", title,
+			"{genre}", c.Genre,
+			"{quality}", string(quality),
+			"{volume}", volume,
+		).Replace(format)
+	}
+	if s := info.String(); s != "" {
+		status = fmt.Sprintf("%s · %s", status, s)
+	}
+	return status
+}
+
+func (m model) View() string {
+	if m.quitting {
+		return ""
+	}
+	if m.switching {
+		return m.switcherView()
+	}
+	if m.showingLog {
+		return m.mpvLogView()
+	}
+	if m.searching {
+		return docStyle.Render(lipgloss.JoinVertical(lipgloss.Left, m.searchInput.View(), m.list.View()))
+	}
+	if m.editingNote != "" {
+		return docStyle.Render(lipgloss.JoinVertical(lipgloss.Left, m.noteInput.View(), m.list.View()))
+	}
+	if len(m.list.Items()) == 0 {
+		return docStyle.Render(m.emptyView())
+	}
+	if m.showDetails {
+		return docStyle.Render(lipgloss.JoinVertical(lipgloss.Left, m.list.View(), detailsStyle.Render(m.details.View())))
+	}
+	return docStyle.Render(m.list.View())
+}
+
+// emptyView replaces the list when there is nothing to show, with a hint at
+// how to get something listed.
+func (m model) emptyView() string {
+	hint := "No channels: press R to fetch the list again, or run soma --reset-cache."
+	if m.searchResults != nil {
+		hint = fmt.Sprintf("Nothing matches %q: esc goes back to the full list.", m.searchQuery)
+	} else if m.favoritesView {
+		hint = "No favorites yet: F goes back to the full list, where f marks a channel as a favorite."
+	}
+	return lipgloss.JoinVertical(lipgloss.Left,
+		m.list.Styles.TitleBar.Render(m.list.Styles.Title.Render(m.list.Title)),
+		m.list.Styles.NoItems.Render(hint))
+}
+
+func (m *model) RegisterMpvEventHandler(p *tea.Program) {
+	client := m.player.Client()
+	client.ObserveProperty("media-title")
+	client.ObserveProperty("core-idle")
+	client.ObserveProperty("paused-for-cache")
+	client.ObserveProperty("pause")
+	client.ObserveProperty("metadata")
+	client.ObserveProperty("idle-active")
+	client.ObserveProperty("volume")
+	client.ObserveProperty("mute")
+	client.RegisterHandler(func(r *mpv.Response) {
+		defer recoverCrash(p)
+		if msg := mpvEventMsg(r); msg != nil {
+			p.Send(msg)
+		}
+	})
+}
+
+// mpvEventMsg turns the changes of the properties RegisterMpvEventHandler
+// observes into messages for Update, or nil.
+func mpvEventMsg(r *mpv.Response) tea.Msg {
+	if r.Event != "property-change" {
+		return nil
+	}
+	switch r.Name {
+	case "media-title":
+		if title, ok := r.Data.(string); ok {
+			return currentTitleUpdateMsg{title: title}
+		}
+	case "core-idle":
+		if idle, ok := r.Data.(bool); ok {
+			return changePausedStatusMsg{paused: idle}
+		}
+	case "paused-for-cache":
+		if buffering, ok := r.Data.(bool); ok {
+			return bufferingMsg{buffering: buffering}
+		}
+	case "pause":
+		if paused, ok := r.Data.(bool); ok {
+			return pauseMsg{paused: paused}
+		}
+	case "volume":
+		if v, ok := r.Data.(float64); ok {
+			return volumeMsg{volume: v}
+		}
+	case "mute":
+		if muted, ok := r.Data.(bool); ok {
+			return muteMsg{muted: muted}
+		}
+	case "idle-active":
+		if idle, ok := r.Data.(bool); ok {
+			return idleMsg{idle: idle}
+		}
+	case "metadata":
+		metadata, _ := r.Data.(map[string]interface{})
+		return metadataMsg{info: somafm.ParseStreamInfo(metadata)}
+	}
+	return nil
+}
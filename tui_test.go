@@ -0,0 +1,614 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+	mpv "github.com/nbr23/go-mpv"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+// nopModel lets tests make a tea.Program that is never run.
+type nopModel struct{}
+
+func (nopModel) Init() tea.Cmd                       { return nil }
+func (nopModel) Update(tea.Msg) (tea.Model, tea.Cmd) { return nopModel{}, nil }
+func (nopModel) View() string                        { return "" }
+
+// testChannels returns n channels, chan0 to chan<n-1>.
+func testChannels(n int) []somafm.Channel {
+	channels := make([]somafm.Channel, n)
+	for i := range channels {
+		channels[i] = somafm.Channel{
+			Id:           fmt.Sprintf("chan%d", i),
+			ChannelTitle: fmt.Sprintf("Channel %d", i),
+			Genre:        "ambient",
+			Listeners:    i,
+		}
+	}
+	return channels
+}
+
+// newTestModel sets up the interface on config in a 100x30 terminal, with a
+// player that never reaches mpv and the config saved to a scratch file.
+func newTestModel(t *testing.T, config *somaConfig) model {
+	t.Helper()
+	dir := t.TempDir()
+	configFile = filepath.Join(dir, "soma.json")
+	t.Cleanup(func() { configFile = "" })
+	m := newModel(context.Background(), somafm.NewPlayer(filepath.Join(dir, "mpv.sock"), false), config)
+	return update(t, m, tea.WindowSizeMsg{Width: 100, Height: 30})
+}
+
+// update sends msg to m and returns the updated model.
+func update(t *testing.T, m model, msg tea.Msg) model {
+	t.Helper()
+	updated, _ := m.Update(msg)
+	return updated.(model)
+}
+
+// press sends the keys to m, each a character or a key name such as "enter".
+func press(t *testing.T, m model, keys ...string) model {
+	t.Helper()
+	for _, k := range keys {
+		m = update(t, m, keyMsg(k))
+	}
+	return m
+}
+
+func keyMsg(k string) tea.KeyMsg {
+	switch k {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case "down":
+		return tea.KeyMsg{Type: tea.KeyDown}
+	case "up":
+		return tea.KeyMsg{Type: tea.KeyUp}
+	case "tab":
+		return tea.KeyMsg{Type: tea.KeyTab}
+	case " ":
+		return tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
+
+func TestReboundKeys(t *testing.T) {
+	config := defaultConfig()
+	config.Channels.Channels = testChannels(60)
+	config.Keys = map[string]string{"favorite": "z"}
+	m := newTestModel(t, config)
+
+	m = press(t, m, "z")
+	if !config.isFavorite("chan0") {
+		t.Error("z didn't favorite the channel")
+	}
+	// f, left by favorite, pages the list again.
+	m = press(t, m, "f")
+	if m.list.Paginator.Page != 1 {
+		t.Errorf("f went to page %d, want 1", m.list.Paginator.Page)
+	}
+	if config.isFavorite(selectedID(m)) {
+		t.Error("f favorited a channel")
+	}
+}
+
+func selectedID(m model) string {
+	c, _ := m.selectedChannel()
+	return c.Id
+}
+
+// The selection is saved by id, and restored wherever the current sort puts
+// the channel.
+func TestSelectionRestoredAfterSortChange(t *testing.T) {
+	tests := []struct {
+		name string
+		sort somafm.SortOrder
+	}{
+		{"default", nil},
+		{"title", somafm.SortOrder{somafm.SortTitle}},
+		{"listeners", somafm.SortOrder{somafm.SortListeners}},
+		{"favorites", somafm.SortOrder{somafm.SortFavorites}},
+		{"favorites then listeners", somafm.SortOrder{somafm.SortFavorites, somafm.SortListeners}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(5)
+			config.Favorites = []string{"chan3"}
+			config.Selected = "chan1"
+			config.SortMode = tt.sort
+			m := newTestModel(t, config)
+			if got := selectedID(m); got != "chan1" {
+				t.Errorf("restored %q, want chan1", got)
+			}
+			// Going through the sort modes keeps the cursor on the channel.
+			for range somafm.SortModes {
+				m = press(t, m, "o")
+				if got := selectedID(m); got != "chan1" {
+					t.Fatalf("sorting by %s selected %q, want chan1", m.config.SortMode, got)
+				}
+			}
+		})
+	}
+}
+
+func TestQualityKeysOnBattery(t *testing.T) {
+	tests := []struct {
+		name      string
+		onBattery bool
+		key       string
+		want      somafm.Quality
+		status    string
+	}{
+		{"plugged in", false, "2", somafm.QualityFast, "Quality: fast"},
+		{"on battery", true, "1", somafm.QualityHighest, "Quality: highest, battery saver off"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(3)
+			m := newTestModel(t, config)
+			m.onBattery = tt.onBattery
+			if tt.onBattery {
+				m.player.SetQuality(somafm.QualitySlow)
+			}
+			m = press(t, m, tt.key)
+			if got := m.player.Quality(); got != tt.want {
+				t.Errorf("quality %s, want %s", got, tt.want)
+			}
+			if !strings.Contains(m.View(), tt.status) {
+				t.Errorf("status bar doesn't say %q:\n%s", tt.status, m.View())
+			}
+		})
+	}
+}
+
+func TestPlayingMark(t *testing.T) {
+	config := defaultConfig()
+	config.Channels.Channels = testChannels(3)
+	m := newTestModel(t, config)
+	marked := func(m model, title string) bool {
+		return strings.Contains(m.View(), playingGlyph+" "+title)
+	}
+
+	m = update(t, m, webPlayMsg{id: "chan1"})
+	if !marked(m, "Channel 1") {
+		t.Errorf("Channel 1 not marked playing:\n%s", m.View())
+	}
+	m = update(t, m, webPlayMsg{id: "chan2"})
+	if marked(m, "Channel 1") || !marked(m, "Channel 2") {
+		t.Errorf("mark didn't move to Channel 2:\n%s", m.View())
+	}
+}
+
+func TestPlayingMarkSurvivesRebuilds(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		{"favorite", []string{"f"}},
+		{"sort", []string{"o"}},
+		{"favorites view", []string{"f", "F"}},
+		{"filter", []string{"/", "1", "enter"}},
+		{"refresh", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(3)
+			m := newTestModel(t, config)
+			m = update(t, m, webPlayMsg{id: "chan1"})
+			m = press(t, m, tt.keys...)
+			if tt.keys == nil {
+				m = update(t, m, channelsMsg{channels: &somafm.Channels{Channels: testChannels(4)}})
+			}
+			view := m.View()
+			if !strings.Contains(view, playingGlyph+" Channel 1") {
+				t.Errorf("Channel 1 not marked playing:\n%s", view)
+			}
+			if n := strings.Count(view, playingGlyph); n != 1 {
+				t.Errorf("%d channels marked playing:\n%s", n, view)
+			}
+		})
+	}
+}
+
+func TestFormatNowPlaying(t *testing.T) {
+	c := &somafm.Channel{Id: "groovesalad", ChannelTitle: "Groove Salad", Genre: "ambient|electronica"}
+	tests := []struct {
+		name    string
+		format  string
+		title   string
+		quality somafm.Quality
+		volume  string
+		info    somafm.StreamInfo
+		want    string
+	}{
+		{
+			name:  "default",
+			title: "Boards of Canada - Dayvan Cowboy",
+			want:  "♫ Now playing: « Groove Salad | Boards of Canada - Dayvan Cowboy »",
+		},
+		{
+			name:  "stream info",
+			title: "Song",
+			info:  somafm.StreamInfo{Name: "Groove Salad: a nicely chilled plate", Bitrate: "128"},
+			want:  "♫ Now playing: « Groove Salad | Song » · Groove Salad: a nicely chilled plate · 128 kbps",
+		},
+		{
+			name:    "format",
+			format:  "{channel} ({id}, {genre}) {title} [{quality} {volume}]",
+			title:   "Song",
+			quality: somafm.QualityFast,
+			volume:  "40%",
+			want:    "Groove Salad (groovesalad, ambient|electronica) Song [fast 40%]",
+		},
+		{
+			name:   "format without volume",
+			format: "{title} {volume}",
+			title:  "Song",
+			want:   "Song ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatNowPlaying(tt.format, c, tt.title, tt.quality, tt.volume, tt.info); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNowPlayingStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		paused bool
+		want   string
+	}{
+		{name: "cursor on the playing channel", want: "« Channel 1 | Song »"},
+		{name: "cursor on another channel", keys: []string{"down"}, want: "« Channel 1 | Song »"},
+		{name: "cursor back", keys: []string{"down", "up", "up"}, want: "« Channel 1 | Song »"},
+		{name: "paused elsewhere", keys: []string{"down"}, paused: true, want: "« Channel 1 | Song »"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(3)
+			m := newTestModel(t, config)
+			m = update(t, m, tea.WindowSizeMsg{Width: 200, Height: 30})
+			m = update(t, m, webPlayMsg{id: "chan1"})
+			m = press(t, m, tt.keys...)
+			if tt.paused {
+				m.playing = ""
+			}
+			m = update(t, m, titleSettledMsg{seq: m.titleSeq, title: "Song"})
+			view := m.View()
+			if !strings.Contains(view, tt.want) {
+				t.Errorf("status doesn't say %q:\n%s", tt.want, view)
+			}
+			for _, other := range []string{"« Channel 0", "« Channel 2"} {
+				if strings.Contains(view, other) {
+					t.Errorf("status names the selected channel:\n%s", view)
+				}
+			}
+		})
+	}
+}
+
+// The title mpv reports is shown with the playing channel's name, not
+// that of the channel the cursor moved to.
+func TestTitleUpdateNamesPlayingChannel(t *testing.T) {
+	config := defaultConfig()
+	config.Channels.Channels = testChannels(3)
+	config.TitleDebounceMs = 0
+	m := newTestModel(t, config)
+	m = update(t, m, tea.WindowSizeMsg{Width: 200, Height: 30})
+	m = update(t, m, webPlayMsg{id: "chan0"})
+	m = press(t, m, "down", "down")
+	if id := selectedID(m); id != "chan2" {
+		t.Fatalf("cursor on %s, want chan2", id)
+	}
+	m = update(t, m, currentTitleUpdateMsg{title: "Artist - Song"})
+	view := m.View()
+	if !strings.Contains(view, "« Channel 0 | Artist - Song »") || strings.Contains(view, "« Channel 2") {
+		t.Errorf("status doesn't name Channel 0:\n%s", view)
+	}
+}
+
+func TestEmptyList(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels []somafm.Channel
+		keys     []string
+		hint     string
+	}{
+		{"no channels", nil, []string{"enter", "f", "u", "N", "esc", "i", "K", "J", "n", "p", "O", "enter"}, "No channels: press R"},
+		{"no favorites", testChannels(3), []string{"F", "enter", "f", "u", "K", "J", "enter"}, "No favorites yet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = tt.channels
+			m := newTestModel(t, config)
+			m = press(t, m, tt.keys...)
+			m = update(t, m, tea.MouseMsg{X: 5, Y: 4, Action: tea.MouseActionPress, Button: tea.MouseButtonLeft})
+			if m.playing != "" {
+				t.Errorf("playing %s", m.playing)
+			}
+			if len(config.Favorites) != 0 {
+				t.Errorf("favorites %v", config.Favorites)
+			}
+			if view := m.View(); !strings.Contains(view, tt.hint) {
+				t.Errorf("no %q hint:\n%s", tt.hint, view)
+			}
+		})
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		width int
+		want  string
+	}{
+		{"ascii fits", "Groove Salad", 20, "Groove Salad"},
+		{"ascii cut", "Groove Salad", 8, "Groove …"},
+		{"accents", "Café Müsique Élégante", 12, "Café Müsiqu…"},
+		{"combining", "Café del Mar", 6, "Café …"},
+		{"wide", "東京ラジオ局", 7, "東京ラ…"},
+		{"wide on the edge", "東京ラジオ局", 6, "東京…"},
+		{"emoji", "🎧 Beat Blender", 8, "🎧 Beat…"},
+		{"newlines and tabs", "Deep\nSpace\tOne", 20, "Deep Space One"},
+		{"no room", "Groove Salad", 0, ""},
+		{"narrower than nothing", "Groove Salad", -3, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fitWidth(tt.s, tt.width)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if w := runewidth.StringWidth(got); w > max(tt.width, 0) {
+				t.Errorf("%q is %d cells wide, more than %d", got, w, tt.width)
+			}
+		})
+	}
+}
+
+// Non-ASCII channels don't push their lines past the terminal width.
+func TestNonASCIIChannelsFit(t *testing.T) {
+	config := defaultConfig()
+	config.Channels.Channels = []somafm.Channel{
+		{Id: "cafe", ChannelTitle: "Café Müsique: Élégante Lounge Française pour les après-midis pluvieux", Genre: "lounge"},
+		{Id: "tokyo", ChannelTitle: "東京ラジオ局 深夜のアンビエント 東京ラジオ局 深夜のアンビエント 東京ラジオ局", Genre: "ambient"},
+		{Id: "combining", ChannelTitle: strings.Repeat("Café ", 20), Genre: "jazz"},
+		{Id: "emoji", ChannelTitle: strings.Repeat("🎧 Beat Blender ", 6), Genre: "electronic"},
+	}
+	m := newTestModel(t, config)
+	for _, width := range []int{40, 60, 100} {
+		m = update(t, m, tea.WindowSizeMsg{Width: width, Height: 30})
+		for i, line := range strings.Split(m.View(), "\n") {
+			if w := lipgloss.Width(line); w > width {
+				t.Errorf("width %d: line %d is %d cells wide: %q", width, i, w, line)
+			}
+		}
+	}
+}
+
+// A pause from mpv's own keys or socket ends up in the saved config.
+func TestPauseObservedFromMpv(t *testing.T) {
+	tests := []struct {
+		name      string
+		wasPaused bool
+		attached  bool
+		paused    bool
+		want      bool
+	}{
+		{name: "paused", paused: true, want: true},
+		{name: "resumed", wasPaused: true, paused: false, want: false},
+		{name: "attached to something else", attached: true, paused: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(3)
+			config.CurrentlyPlaying = "chan1"
+			config.IsPaused = tt.wasPaused
+			m := newTestModel(t, config)
+			m.attached = tt.attached
+			msg := mpvEventMsg(&mpv.Response{Event: "property-change", Name: "pause", Data: tt.paused})
+			m = update(t, m, msg)
+			if config.IsPaused != tt.want {
+				t.Errorf("IsPaused %t, want %t", config.IsPaused, tt.want)
+			}
+
+			if err := m.config.saveConfig(); err != nil {
+				t.Fatal(err)
+			}
+			saved, err := loadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.IsPaused != tt.want {
+				t.Errorf("saved isPaused %t, want %t", saved.IsPaused, tt.want)
+			}
+		})
+	}
+}
+
+func TestMpvEventMsg(t *testing.T) {
+	tests := []struct {
+		name string
+		data any
+		want tea.Msg
+	}{
+		{"pause", true, pauseMsg{paused: true}},
+		{"core-idle", false, changePausedStatusMsg{paused: false}},
+		{"paused-for-cache", true, bufferingMsg{buffering: true}},
+		{"media-title", "Artist - Song", currentTitleUpdateMsg{title: "Artist - Song"}},
+		{"volume", 40.0, volumeMsg{volume: 40}},
+		{"mute", true, muteMsg{muted: true}},
+		{"idle-active", true, idleMsg{idle: true}},
+		{"metadata", map[string]any{"icy-br": "128"}, metadataMsg{info: somafm.StreamInfo{Bitrate: "128"}}},
+		{"pause", nil, nil},
+		{"media-title", nil, nil},
+		{"volume", "loud", nil},
+		{"time-pos", 3.0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mpvEventMsg(&mpv.Response{Event: "property-change", Name: tt.name, Data: tt.data}); got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwitcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		playing string
+		status  string
+	}{
+		{"favorite", []string{"tab", "1"}, "chan1", ""},
+		{"recent", []string{"r", "1"}, "chan2", ""},
+		{"dropped favorite", []string{"tab", "2"}, "", "gone is no longer listed"},
+		{"dropped recent", []string{"r", "2"}, "", "gone is no longer listed"},
+		{"past the end", []string{"tab", "3"}, "", ""},
+		{"other key", []string{"tab", "x"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(3)
+			config.Favorites = []string{"chan1", "gone"}
+			config.Recent = []string{"chan2", "gone"}
+			m := newTestModel(t, config)
+			m = press(t, m, tt.keys...)
+			if m.switching {
+				t.Error("switcher still open")
+			}
+			if m.playing != tt.playing || m.config.CurrentlyPlaying != tt.playing {
+				t.Errorf("playing %q, saved %q, want %q", m.playing, m.config.CurrentlyPlaying, tt.playing)
+			}
+			if view := m.View(); tt.status != "" && !strings.Contains(view, tt.status) {
+				t.Errorf("no %q in:\n%s", tt.status, view)
+			}
+		})
+	}
+}
+
+func TestArtworkForMPRIS(t *testing.T) {
+	const art = "https://somafm.com/img/chan1.png"
+	tests := []struct {
+		name string
+		msg  artworkMsg
+		want string
+	}{
+		{"downloaded", artworkMsg{url: art, path: "/cache/soma/artwork/chan 1"}, "file:///cache/soma/artwork/chan%201"},
+		{"failed", artworkMsg{url: art, err: somafm.ErrNetwork}, ""},
+		{"other image", artworkMsg{url: "https://somafm.com/img/chan0.png", path: "/cache/chan0"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(2)
+			config.Channels.Channels[1].XLImage = art
+			m := newTestModel(t, config)
+			m = update(t, m, webPlayMsg{id: "chan1"})
+			// Without a session bus nothing is fetched: act as if it was.
+			m.artworkURL = art
+			m = update(t, m, tt.msg)
+			if got := m.mprisState().artwork; got != tt.want {
+				t.Errorf("artwork %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// u queues the selected channel, and never pages the list back as the
+// list's own u would.
+func TestQueueKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		attached bool
+		queued   bool
+	}{
+		{"channel", false, true},
+		{"attached", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(60)
+			m := newTestModel(t, config)
+			m = update(t, m, webPlayMsg{id: "chan0"})
+			m.attached = tt.attached
+			m = press(t, m, "d")
+			page := m.list.Paginator.Page
+			if page == 0 {
+				t.Fatal("d didn't change page")
+			}
+			m = press(t, m, "u")
+			if m.list.Paginator.Page != page {
+				t.Errorf("u moved to page %d from %d", m.list.Paginator.Page, page)
+			}
+			if queued := m.queued != ""; queued != tt.queued {
+				t.Errorf("queued %q, want queued %t", m.queued, tt.queued)
+			}
+		})
+	}
+
+	config := defaultConfig()
+	config.Channels.Channels = testChannels(3)
+	m := press(t, newTestModel(t, config), "/", "u")
+	if got := m.list.FilterValue(); got != "u" {
+		t.Errorf("filter %q, want u", got)
+	}
+}
+
+func TestFavoriteKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		header bool
+		want   []string
+	}{
+		{"channel", false, []string{"chan0"}},
+		{"genre header", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Channels.Channels = testChannels(60)
+			config.GroupByGenre = true
+			m := newTestModel(t, config)
+			m.list.Select(0)
+			if !tt.header {
+				m = press(t, m, "down")
+			}
+			if _, ok := m.list.SelectedItem().(genreHeader); ok != tt.header {
+				t.Fatalf("header selected %t, want %t", ok, tt.header)
+			}
+			m = press(t, m, "f")
+			if m.list.Paginator.Page != 0 {
+				t.Errorf("f moved to page %d", m.list.Paginator.Page)
+			}
+			if !slices.Equal(m.config.Favorites, tt.want) {
+				t.Errorf("favorites %q, want %q", m.config.Favorites, tt.want)
+			}
+		})
+	}
+}
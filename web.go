@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+//go:embed web.html
+var webPage string
+
+var webTemplate = template.Must(template.New("web").Parse(webPage))
+
+// webServer serves a small page and JSON API to control soma from another
+// device, e.g. a phone on the same network. Like the MPRIS server, it sends
+// what it is asked for to the interface and shows what update last reported.
+type webServer struct {
+	addr string
+
+	mu       sync.Mutex
+	state    mprisState
+	channels []somafm.Channel
+}
+
+// newWebServer returns a server for addr, or nil, whose methods do nothing,
+// if addr is empty.
+func newWebServer(addr string) *webServer {
+	if addr == "" {
+		return nil
+	}
+	return &webServer{addr: webListenAddr(addr)}
+}
+
+// webListenAddr binds to localhost unless addr names a host: "8080" and
+// ":8080" only accept local connections, "0.0.0.0:8080" any.
+func webListenAddr(addr string) string {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	return addr
+}
+
+// webPlayMsg asks the interface to play a channel from the web page.
+type webPlayMsg struct {
+	id string
+}
+
+// webChannel is a channel as listed by /api/channels.
+type webChannel struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Genre     string `json:"genre"`
+	Listeners int    `json:"listeners"`
+	Playing   bool   `json:"playing"`
+}
+
+// webStatus is what /api/status reports.
+type webStatus struct {
+	Status  string `json:"status"`
+	Channel string `json:"channel,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Track   string `json:"track,omitempty"`
+	Volume  int    `json:"volume"`
+}
+
+func (s *webServer) update(state mprisState, channels []somafm.Channel) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	s.channels = channels
+}
+
+func (s *webServer) snapshot() (webStatus, []webChannel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := webStatus{Status: s.state.status, Track: s.state.title, Volume: int(s.state.volume)}
+	if s.state.channel != nil {
+		status.Channel = s.state.channel.Id
+		status.Title = s.state.channel.ChannelTitle
+	}
+	channels := make([]webChannel, 0, len(s.channels))
+	for _, c := range s.channels {
+		channels = append(channels, webChannel{
+			ID:        c.Id,
+			Title:     c.ChannelTitle,
+			Genre:     c.Genre,
+			Listeners: c.Listeners,
+			Playing:   c.Id == status.Channel,
+		})
+	}
+	return status, channels
+}
+
+func (s *webServer) known(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := somafm.Channels{Channels: s.channels}.Find(id)
+	return ok
+}
+
+// serve starts listening, so that a busy address is reported before the
+// interface starts, and serves until ctx is done.
+func (s *webServer) serve(ctx context.Context, p *tea.Program) error {
+	if s == nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	logger.Info("serving web interface", "addr", ln.Addr())
+
+	srv := &http.Server{Handler: s.handler(p), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		defer recoverCrash(p)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("serving web interface", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	return nil
+}
+
+func (s *webServer) handler(p *tea.Program) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		status, channels := s.snapshot()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := webTemplate.Execute(w, struct {
+			Status   webStatus
+			Channels []webChannel
+		}{status, channels}); err != nil {
+			logger.Warn("rendering web page", "error", err)
+		}
+	})
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		status, _ := s.snapshot()
+		writeJSON(w, status)
+	})
+	mux.HandleFunc("GET /api/channels", func(w http.ResponseWriter, r *http.Request) {
+		_, channels := s.snapshot()
+		writeJSON(w, channels)
+	})
+
+	// The page posts forms and is sent back to itself, API clients get an
+	// empty 202: the interface takes the request right after.
+	mux.HandleFunc("POST /play", func(w http.ResponseWriter, r *http.Request) {
+		if s.play(w, r, p) {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		}
+	})
+	mux.HandleFunc("POST /api/play", func(w http.ResponseWriter, r *http.Request) {
+		if s.play(w, r, p) {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+	mux.HandleFunc("POST /toggle", func(w http.ResponseWriter, r *http.Request) {
+		p.Send(mprisMsg{action: mprisPlayPause})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+	mux.HandleFunc("POST /api/toggle", func(w http.ResponseWriter, r *http.Request) {
+		p.Send(mprisMsg{action: mprisPlayPause})
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return sameOrigin(mux)
+}
+
+// sameOrigin refuses POSTs sent from other sites' pages, which a browser
+// would otherwise send on their behalf. Browsers tell where a request comes
+// from with Origin or Sec-Fetch-Site, API clients such as curl send neither.
+func sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && !fromSameOrigin(r) {
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func fromSameOrigin(r *http.Request) bool {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+	site := r.Header.Get("Sec-Fetch-Site")
+	return site == "" || site == "same-origin" || site == "none"
+}
+
+// play asks the interface to play the channel in the id form or query value.
+func (s *webServer) play(w http.ResponseWriter, r *http.Request, p *tea.Program) bool {
+	id := r.FormValue("id")
+	if !s.known(id) {
+		http.Error(w, "unknown channel", http.StatusNotFound)
+		return false
+	}
+	p.Send(webPlayMsg{id: id})
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("writing web response", "error", err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/nbr23/soma/somafm"
+)
+
+func TestWebOrigin(t *testing.T) {
+	// A program that is done drops what the handlers send it.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := tea.NewProgram(nopModel{}, tea.WithContext(ctx))
+	s := newWebServer("8080")
+	s.update(mprisState{}, []somafm.Channel{{Id: "dronezone", ChannelTitle: "Drone Zone"}})
+	h := s.handler(p)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"api client", "POST", "/api/toggle", nil, http.StatusAccepted},
+		{"own page", "POST", "/toggle", map[string]string{"Origin": "http://localhost:8080"}, http.StatusSeeOther},
+		{"own page without origin", "POST", "/play?id=dronezone", map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusSeeOther},
+		{"typed in", "POST", "/api/toggle", map[string]string{"Sec-Fetch-Site": "none"}, http.StatusAccepted},
+		{"other site", "POST", "/api/play?id=dronezone", map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden},
+		{"other port", "POST", "/toggle", map[string]string{"Origin": "http://localhost:9090"}, http.StatusForbidden},
+		{"opaque origin", "POST", "/toggle", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"cross site without origin", "POST", "/api/toggle", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"unknown channel", "POST", "/api/play?id=nope", map[string]string{"Origin": "http://localhost:8080"}, http.StatusNotFound},
+		{"status from anywhere", "GET", "/api/status", map[string]string{"Origin": "http://evil.example"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://localhost:8080"+tt.path, strings.NewReader(""))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}